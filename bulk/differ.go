@@ -1,6 +1,7 @@
 package bulk
 
 import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
 	"github.com/cloudfoundry-incubator/receptor"
 	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
 	"github.com/pivotal-golang/lager"
@@ -14,24 +15,29 @@ type Differ interface {
 
 	Missing() <-chan []cc_messages.CCDesiredAppFingerprint
 
+	// Outdated LRPs were built by an older recipe builder and need rebuilding.
+	Outdated() <-chan []cc_messages.CCDesiredAppFingerprint
+
 	Deleted() <-chan []string
 }
 
 type differ struct {
 	existing []receptor.DesiredLRPResponse
 
-	stale   chan []cc_messages.CCDesiredAppFingerprint
-	missing chan []cc_messages.CCDesiredAppFingerprint
-	deleted chan []string
+	stale    chan []cc_messages.CCDesiredAppFingerprint
+	missing  chan []cc_messages.CCDesiredAppFingerprint
+	outdated chan []cc_messages.CCDesiredAppFingerprint
+	deleted  chan []string
 }
 
 func NewDiffer(existing []receptor.DesiredLRPResponse) Differ {
 	return &differ{
 		existing: existing,
 
-		stale:   make(chan []cc_messages.CCDesiredAppFingerprint, 1),
-		missing: make(chan []cc_messages.CCDesiredAppFingerprint, 1),
-		deleted: make(chan []string, 1),
+		stale:    make(chan []cc_messages.CCDesiredAppFingerprint, 1),
+		missing:  make(chan []cc_messages.CCDesiredAppFingerprint, 1),
+		outdated: make(chan []cc_messages.CCDesiredAppFingerprint, 1),
+		deleted:  make(chan []string, 1),
 	}
 }
 
@@ -48,6 +54,7 @@ func (d *differ) Diff(
 		defer func() {
 			close(d.missing)
 			close(d.stale)
+			close(d.outdated)
 			close(d.deleted)
 			close(errc)
 		}()
@@ -70,6 +77,7 @@ func (d *differ) Diff(
 
 				missing := []cc_messages.CCDesiredAppFingerprint{}
 				stale := []cc_messages.CCDesiredAppFingerprint{}
+				outdated := []cc_messages.CCDesiredAppFingerprint{}
 
 				for _, fingerprint := range batch {
 					desiredLRP, found := existingLRPs[fingerprint.ProcessGuid]
@@ -85,7 +93,32 @@ func (d *differ) Diff(
 
 					delete(existingLRPs, fingerprint.ProcessGuid)
 
-					if desiredLRP.Annotation != fingerprint.ETag {
+					annotation := recipebuilder.ParseAnnotation(desiredLRP.Annotation)
+
+					// Updating LRPs from before recipe versions stamps the current
+					// version on them, rather than recreating every LRP on upgrade.
+					if annotation.IsLegacy() {
+						logger.Info("found-legacy-lrp", lager.Data{
+							"guid": fingerprint.ProcessGuid,
+							"etag": fingerprint.ETag,
+						})
+
+						stale = append(stale, fingerprint)
+						continue
+					}
+
+					if !annotation.IsCurrentRecipe() {
+						logger.Info("found-outdated-lrp", lager.Data{
+							"guid":           fingerprint.ProcessGuid,
+							"etag":           fingerprint.ETag,
+							"recipe-version": annotation.RecipeVersion,
+						})
+
+						outdated = append(outdated, fingerprint)
+						continue
+					}
+
+					if annotation.ETag != fingerprint.ETag {
 						logger.Info("found-stale-lrp", lager.Data{
 							"guid": fingerprint.ProcessGuid,
 							"etag": fingerprint.ETag,
@@ -110,6 +143,14 @@ func (d *differ) Diff(
 						return
 					}
 				}
+
+				if len(outdated) > 0 {
+					select {
+					case d.outdated <- outdated:
+					case <-cancel:
+						return
+					}
+				}
 			}
 		}
 	}()
@@ -144,6 +185,10 @@ func (d *differ) Missing() <-chan []cc_messages.CCDesiredAppFingerprint {
 	return d.missing
 }
 
+func (d *differ) Outdated() <-chan []cc_messages.CCDesiredAppFingerprint {
+	return d.outdated
+}
+
 func (d *differ) Deleted() <-chan []string {
 	return d.deleted
 }
@@ -2,6 +2,7 @@ package bulk_test
 
 import (
 	"github.com/cloudfoundry-incubator/nsync/bulk"
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
 	"github.com/cloudfoundry-incubator/receptor"
 	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
 	"github.com/cloudfoundry-incubator/runtime-schema/models"
@@ -19,9 +20,10 @@ var _ = Describe("Differ", func() {
 		cancelChan  chan struct{}
 		desiredChan chan []cc_messages.CCDesiredAppFingerprint
 
-		staleChan   <-chan []cc_messages.CCDesiredAppFingerprint
-		missingChan <-chan []cc_messages.CCDesiredAppFingerprint
-		deletedChan <-chan []string
+		staleChan    <-chan []cc_messages.CCDesiredAppFingerprint
+		missingChan  <-chan []cc_messages.CCDesiredAppFingerprint
+		outdatedChan <-chan []cc_messages.CCDesiredAppFingerprint
+		deletedChan  <-chan []string
 
 		errorsChan <-chan error
 
@@ -40,12 +42,12 @@ var _ = Describe("Differ", func() {
 				From: "http://example.com",
 				To:   "/tmp/internet",
 			},
-			Annotation: "some-etag-1",
+			Annotation: recipebuilder.NewAnnotation("some-etag-1").String(),
 		}
 
 		existingAppFingerprint = cc_messages.CCDesiredAppFingerprint{
 			ProcessGuid: existingLRP.ProcessGuid,
-			ETag:        existingLRP.Annotation,
+			ETag:        "some-etag-1",
 		}
 
 		desiredChan = make(chan []cc_messages.CCDesiredAppFingerprint, 1)
@@ -57,6 +59,7 @@ var _ = Describe("Differ", func() {
 
 		staleChan = differ.Stale()
 		missingChan = differ.Missing()
+		outdatedChan = differ.Outdated()
 		deletedChan = differ.Deleted()
 
 		errorsChan = differ.Diff(logger, cancelChan, desiredChan)
@@ -65,6 +68,7 @@ var _ = Describe("Differ", func() {
 	AfterEach(func() {
 		Eventually(staleChan).Should(BeClosed())
 		Eventually(missingChan).Should(BeClosed())
+		Eventually(outdatedChan).Should(BeClosed())
 		Eventually(deletedChan).Should(BeClosed())
 		Eventually(errorsChan).Should(BeClosed())
 	})
@@ -87,6 +91,39 @@ var _ = Describe("Differ", func() {
 			It("sends nothing to downstream channels", func() {
 				Consistently(staleChan).ShouldNot(Receive())
 				Consistently(missingChan).ShouldNot(Receive())
+				Consistently(outdatedChan).ShouldNot(Receive())
+				Consistently(deletedChan).ShouldNot(Receive())
+			})
+		})
+
+		Context("and an existing desired LRP was built by an older recipe builder", func() {
+			BeforeEach(func() {
+				existingLRP.Annotation = `{"etag":"some-etag-1","recipe_version":"0"}`
+
+				desiredChan <- desiredAppFingerprints
+				close(desiredChan)
+			})
+
+			It("sends its fingerprint across the outdated channel", func() {
+				Eventually(outdatedChan).Should(Receive(ConsistOf(existingAppFingerprint)))
+
+				Consistently(staleChan).ShouldNot(Receive())
+				Consistently(deletedChan).ShouldNot(Receive())
+			})
+		})
+
+		Context("and an existing desired LRP has a plain ETag annotation", func() {
+			BeforeEach(func() {
+				existingLRP.Annotation = "some-etag-1"
+
+				desiredChan <- desiredAppFingerprints
+				close(desiredChan)
+			})
+
+			It("sends its fingerprint across the stale channel so it is updated in place", func() {
+				Eventually(staleChan).Should(Receive(ConsistOf(existingAppFingerprint)))
+
+				Consistently(outdatedChan).ShouldNot(Receive())
 				Consistently(deletedChan).ShouldNot(Receive())
 			})
 		})
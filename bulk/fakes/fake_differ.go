@@ -32,6 +32,12 @@ type FakeDiffer struct {
 	missingReturns     struct {
 		result1 <-chan []cc_messages.CCDesiredAppFingerprint
 	}
+	OutdatedStub        func() <-chan []cc_messages.CCDesiredAppFingerprint
+	outdatedMutex       sync.RWMutex
+	outdatedArgsForCall []struct{}
+	outdatedReturns     struct {
+		result1 <-chan []cc_messages.CCDesiredAppFingerprint
+	}
 	DeletedStub        func() <-chan []string
 	deletedMutex       sync.RWMutex
 	deletedArgsForCall []struct{}
@@ -122,6 +128,30 @@ func (fake *FakeDiffer) MissingReturns(result1 <-chan []cc_messages.CCDesiredApp
 	}{result1}
 }
 
+func (fake *FakeDiffer) Outdated() <-chan []cc_messages.CCDesiredAppFingerprint {
+	fake.outdatedMutex.Lock()
+	fake.outdatedArgsForCall = append(fake.outdatedArgsForCall, struct{}{})
+	fake.outdatedMutex.Unlock()
+	if fake.OutdatedStub != nil {
+		return fake.OutdatedStub()
+	} else {
+		return fake.outdatedReturns.result1
+	}
+}
+
+func (fake *FakeDiffer) OutdatedCallCount() int {
+	fake.outdatedMutex.RLock()
+	defer fake.outdatedMutex.RUnlock()
+	return len(fake.outdatedArgsForCall)
+}
+
+func (fake *FakeDiffer) OutdatedReturns(result1 <-chan []cc_messages.CCDesiredAppFingerprint) {
+	fake.OutdatedStub = nil
+	fake.outdatedReturns = struct {
+		result1 <-chan []cc_messages.CCDesiredAppFingerprint
+	}{result1}
+}
+
 func (fake *FakeDiffer) Deleted() <-chan []string {
 	fake.deletedMutex.Lock()
 	fake.deletedArgsForCall = append(fake.deletedArgsForCall, struct{}{})
@@ -19,6 +19,15 @@ type FakeRecipeBuilder struct {
 		result1 *receptor.DesiredLRPCreateRequest
 		result2 error
 	}
+	BuildUpdateStub        func(*cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPUpdateRequest, error)
+	buildUpdateMutex       sync.RWMutex
+	buildUpdateArgsForCall []struct {
+		arg1 *cc_messages.DesireAppRequestFromCC
+	}
+	buildUpdateReturns struct {
+		result1 *receptor.DesiredLRPUpdateRequest
+		result2 error
+	}
 }
 
 func (fake *FakeRecipeBuilder) Build(arg1 *cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPCreateRequest, error) {
@@ -54,4 +63,37 @@ func (fake *FakeRecipeBuilder) BuildReturns(result1 *receptor.DesiredLRPCreateRe
 	}{result1, result2}
 }
 
+func (fake *FakeRecipeBuilder) BuildUpdate(arg1 *cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPUpdateRequest, error) {
+	fake.buildUpdateMutex.Lock()
+	fake.buildUpdateArgsForCall = append(fake.buildUpdateArgsForCall, struct {
+		arg1 *cc_messages.DesireAppRequestFromCC
+	}{arg1})
+	fake.buildUpdateMutex.Unlock()
+	if fake.BuildUpdateStub != nil {
+		return fake.BuildUpdateStub(arg1)
+	} else {
+		return fake.buildUpdateReturns.result1, fake.buildUpdateReturns.result2
+	}
+}
+
+func (fake *FakeRecipeBuilder) BuildUpdateCallCount() int {
+	fake.buildUpdateMutex.RLock()
+	defer fake.buildUpdateMutex.RUnlock()
+	return len(fake.buildUpdateArgsForCall)
+}
+
+func (fake *FakeRecipeBuilder) BuildUpdateArgsForCall(i int) *cc_messages.DesireAppRequestFromCC {
+	fake.buildUpdateMutex.RLock()
+	defer fake.buildUpdateMutex.RUnlock()
+	return fake.buildUpdateArgsForCall[i].arg1
+}
+
+func (fake *FakeRecipeBuilder) BuildUpdateReturns(result1 *receptor.DesiredLRPUpdateRequest, result2 error) {
+	fake.BuildUpdateStub = nil
+	fake.buildUpdateReturns = struct {
+		result1 *receptor.DesiredLRPUpdateRequest
+		result2 error
+	}{result1, result2}
+}
+
 var _ bulk.RecipeBuilder = new(FakeRecipeBuilder)
@@ -10,8 +10,8 @@ import (
 
 	"github.com/cloudfoundry-incubator/cf_http"
 	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/nsync/recreator"
 	"github.com/cloudfoundry-incubator/receptor"
-	"github.com/cloudfoundry-incubator/route-emitter/cfroutes"
 	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
 	"github.com/cloudfoundry-incubator/runtime-schema/metric"
 	"github.com/pivotal-golang/clock"
@@ -19,12 +19,14 @@ import (
 )
 
 const (
-	syncDesiredLRPsDuration = metric.Duration("DesiredLRPSyncDuration")
+	syncDesiredLRPsDuration  = metric.Duration("DesiredLRPSyncDuration")
+	invalidDesiredLRPCounter = metric.Counter("LRPsDesiredInvalid")
 )
 
 //go:generate counterfeiter -o fakes/fake_recipe_builder.go . RecipeBuilder
 type RecipeBuilder interface {
 	Build(*cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPCreateRequest, error)
+	BuildUpdate(*cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPUpdateRequest, error)
 }
 
 type Processor struct {
@@ -36,6 +38,7 @@ type Processor struct {
 	logger          lager.Logger
 	fetcher         Fetcher
 	builder         RecipeBuilder
+	recreator       recreator.Recreator
 	clock           clock.Clock
 }
 
@@ -48,6 +51,7 @@ func NewProcessor(
 	logger lager.Logger,
 	fetcher Fetcher,
 	builder RecipeBuilder,
+	recreator recreator.Recreator,
 	clock clock.Clock,
 ) *Processor {
 	return &Processor{
@@ -59,6 +63,7 @@ func NewProcessor(
 		logger:          logger,
 		fetcher:         fetcher,
 		builder:         builder,
+		recreator:       recreator,
 		clock:           clock,
 	}
 }
@@ -144,7 +149,16 @@ func (p *Processor) sync(signals <-chan os.Signal, httpClient *http.Client) bool
 		differ.Stale(),
 	)
 
-	updateErrors := p.updateStaleDesiredLRPs(logger, cancel, staleApps)
+	updateErrors := p.updateStaleDesiredLRPs(logger, cancel, staleApps, organizeLRPsByProcessGuid(existing))
+
+	outdatedApps, outdatedAppErrors := p.fetcher.FetchDesiredApps(
+		logger,
+		cancel,
+		httpClient,
+		differ.Outdated(),
+	)
+
+	rebuildErrors := p.rebuildOutdatedDesiredLRPs(logger, cancel, outdatedApps)
 
 	bumpFreshness := true
 	success := true
@@ -156,8 +170,10 @@ func (p *Processor) sync(signals <-chan os.Signal, httpClient *http.Client) bool
 		diffErrors,
 		missingAppsErrors,
 		staleAppErrors,
+		outdatedAppErrors,
 		createErrors,
 		updateErrors,
+		rebuildErrors,
 	)
 
 process_loop:
@@ -230,6 +246,16 @@ func (p *Processor) createMissingDesiredLRPs(
 
 			for _, desireAppRequest := range desireAppRequests {
 				createReq, err := p.builder.Build(&desireAppRequest)
+				if validationErr, ok := err.(recipebuilder.ValidationError); ok {
+					logger.Error("invalid-desired-lrp", err, lager.Data{
+						"process-guid":      desireAppRequest.ProcessGuid,
+						"validation-errors": validationErr.Messages(),
+					})
+					invalidDesiredLRPCounter.Increment()
+					errc <- err
+					continue
+				}
+
 				if err != nil {
 					logger.Error("failed-to-build-create-desired-lrp-request", err, lager.Data{
 						"desire-app-request": desireAppRequest,
@@ -257,6 +283,7 @@ func (p *Processor) updateStaleDesiredLRPs(
 	logger lager.Logger,
 	cancel <-chan struct{},
 	stale <-chan []cc_messages.DesireAppRequestFromCC,
+	existingLRPs map[string]*receptor.DesiredLRPResponse,
 ) <-chan error {
 	logger = logger.Session("update-stale-desired-lrps")
 
@@ -283,14 +310,39 @@ func (p *Processor) updateStaleDesiredLRPs(
 			logger.Info("processing-batch", lager.Data{"size": len(staleAppRequests)})
 
 			for _, desireAppRequest := range staleAppRequests {
-				updateReq := receptor.DesiredLRPUpdateRequest{}
-				updateReq.Instances = &desireAppRequest.NumInstances
-				updateReq.Annotation = &desireAppRequest.ETag
-				updateReq.Routes = cfroutes.CFRoutes{
-					{Hostnames: desireAppRequest.Routes, Port: recipebuilder.DefaultPort},
-				}.RoutingInfo()
-
-				err := p.receptorClient.UpdateDesiredLRP(desireAppRequest.ProcessGuid, updateReq)
+				existingLRP, found := existingLRPs[desireAppRequest.ProcessGuid]
+				if found {
+					recreated, err := p.recreateIfNotUpdatable(logger, existingLRP, &desireAppRequest)
+					if err != nil {
+						errc <- err
+						continue
+					}
+
+					if recreated {
+						continue
+					}
+				}
+
+				updateReq, err := p.builder.BuildUpdate(&desireAppRequest)
+				if validationErr, ok := err.(recipebuilder.ValidationError); ok {
+					logger.Error("invalid-desired-lrp-update", err, lager.Data{
+						"process-guid":      desireAppRequest.ProcessGuid,
+						"validation-errors": validationErr.Messages(),
+					})
+					invalidDesiredLRPCounter.Increment()
+					errc <- err
+					continue
+				}
+
+				if err != nil {
+					logger.Error("failed-to-build-update-desired-lrp-request", err, lager.Data{
+						"desire-app-request": desireAppRequest,
+					})
+					errc <- err
+					continue
+				}
+
+				err = p.receptorClient.UpdateDesiredLRP(desireAppRequest.ProcessGuid, *updateReq)
 				if err != nil {
 					logger.Error("failed-to-update-stale-lrp", err, lager.Data{
 						"update-request": updateReq,
@@ -305,6 +357,88 @@ func (p *Processor) updateStaleDesiredLRPs(
 	return errc
 }
 
+// recreateIfNotUpdatable replaces the existing LRP when the app changed in
+// ways an update cannot apply. If the recipe cannot be built it leaves the
+// LRP to be updated in place, as before.
+func (p *Processor) recreateIfNotUpdatable(
+	logger lager.Logger,
+	existingLRP *receptor.DesiredLRPResponse,
+	desireAppRequest *cc_messages.DesireAppRequestFromCC,
+) (bool, error) {
+	createReq, err := p.builder.Build(desireAppRequest)
+	if err != nil {
+		logger.Error("failed-to-build-recipe-for-comparison", err, lager.Data{
+			"process-guid": desireAppRequest.ProcessGuid,
+		})
+		return false, nil
+	}
+
+	changes := recipebuilder.NonUpdatableChanges(*existingLRP, createReq)
+	if len(changes) == 0 {
+		return false, nil
+	}
+
+	logger.Info("recreating-lrp", lager.Data{
+		"process-guid":   desireAppRequest.ProcessGuid,
+		"changed-fields": changes,
+	})
+
+	return true, p.recreator.Recreate(logger, createReq)
+}
+
+// rebuildOutdatedDesiredLRPs replaces LRPs built by an older recipe builder,
+// since the receptor cannot update a recipe in place.
+func (p *Processor) rebuildOutdatedDesiredLRPs(
+	logger lager.Logger,
+	cancel <-chan struct{},
+	outdated <-chan []cc_messages.DesireAppRequestFromCC,
+) <-chan error {
+	logger = logger.Session("rebuild-outdated-desired-lrps")
+
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+
+		for {
+			var outdatedAppRequests []cc_messages.DesireAppRequestFromCC
+
+			select {
+			case <-cancel:
+				return
+
+			case selected, open := <-outdated:
+				if !open {
+					return
+				}
+
+				outdatedAppRequests = selected
+			}
+
+			logger.Info("processing-batch", lager.Data{"size": len(outdatedAppRequests)})
+
+			for _, desireAppRequest := range outdatedAppRequests {
+				createReq, err := p.builder.Build(&desireAppRequest)
+				if err != nil {
+					logger.Error("failed-to-build-create-desired-lrp-request", err, lager.Data{
+						"desire-app-request": desireAppRequest,
+					})
+					errc <- err
+					continue
+				}
+
+				err = p.recreator.Recreate(logger, createReq)
+				if err != nil {
+					errc <- err
+					continue
+				}
+			}
+		}
+	}()
+
+	return errc
+}
+
 func (p *Processor) getDesiredLRPs(logger lager.Logger) ([]receptor.DesiredLRPResponse, error) {
 	logger.Info("getting-desired-lrps-from-bbs")
 
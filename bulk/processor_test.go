@@ -8,8 +8,11 @@ import (
 
 	"github.com/cloudfoundry-incubator/nsync/bulk"
 	"github.com/cloudfoundry-incubator/nsync/bulk/fakes"
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	fake_recreator "github.com/cloudfoundry-incubator/nsync/recreator/fakes"
 	"github.com/cloudfoundry-incubator/receptor"
 	"github.com/cloudfoundry-incubator/receptor/fake_receptor"
+	"github.com/cloudfoundry-incubator/route-emitter/cfroutes"
 	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
 	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
 	"github.com/cloudfoundry/dropsonde/metrics"
@@ -28,6 +31,7 @@ var _ = Describe("Processor", func() {
 		receptorClient *fake_receptor.FakeClient
 		fetcher        *fakes.FakeFetcher
 		recipeBuilder  *fakes.FakeRecipeBuilder
+		recreator      *fake_recreator.FakeRecreator
 
 		processor ifrit.Runner
 
@@ -54,9 +58,9 @@ var _ = Describe("Processor", func() {
 		}
 
 		existingDesired = []receptor.DesiredLRPResponse{
-			{ProcessGuid: "current-process-guid", Annotation: "current-etag"},
-			{ProcessGuid: "stale-process-guid", Annotation: "stale-etag"},
-			{ProcessGuid: "excess-process-guid", Annotation: "excess-etag"},
+			{ProcessGuid: "current-process-guid", Annotation: recipebuilder.NewAnnotation("current-etag").String()},
+			{ProcessGuid: "stale-process-guid", Annotation: recipebuilder.NewAnnotation("stale-etag").String()},
+			{ProcessGuid: "excess-process-guid", Annotation: recipebuilder.NewAnnotation("excess-etag").String()},
 		}
 
 		fetcher = new(fakes.FakeFetcher)
@@ -110,6 +114,18 @@ var _ = Describe("Processor", func() {
 			}
 			return &createRequest, nil
 		}
+		recipeBuilder.BuildUpdateStub = func(ccRequest *cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPUpdateRequest, error) {
+			updateRequest := receptor.DesiredLRPUpdateRequest{
+				Annotation: &ccRequest.ETag,
+				Instances:  &ccRequest.NumInstances,
+				Routes: cfroutes.CFRoutes{
+					{Hostnames: ccRequest.Routes, Port: 8080},
+				}.RoutingInfo(),
+			}
+			return &updateRequest, nil
+		}
+
+		recreator = new(fake_recreator.FakeRecreator)
 
 		receptorClient = new(fake_receptor.FakeClient)
 		receptorClient.DesiredLRPsByDomainReturns(existingDesired, nil)
@@ -128,6 +144,7 @@ var _ = Describe("Processor", func() {
 			lager.NewLogger("test"),
 			fetcher,
 			recipeBuilder,
+			recreator,
 			clock,
 		)
 	})
@@ -225,14 +242,16 @@ var _ = Describe("Processor", func() {
 
 		Context("and the differ discovers missing apps", func() {
 			It("uses the recipe builder to construct the create LRP request", func() {
-				Eventually(recipeBuilder.BuildCallCount).Should(Equal(1))
-				Consistently(recipeBuilder.BuildCallCount).Should(Equal(1))
+				Eventually(recipeBuilder.BuildCallCount).Should(Equal(2))
+				Consistently(recipeBuilder.BuildCallCount).Should(Equal(2))
 
-				Eventually(recipeBuilder.BuildArgsForCall(0)).Should(Equal(
-					&cc_messages.DesireAppRequestFromCC{
-						ProcessGuid: "new-process-guid",
-						ETag:        "new-etag",
-					}))
+				Ω([]*cc_messages.DesireAppRequestFromCC{
+					recipeBuilder.BuildArgsForCall(0),
+					recipeBuilder.BuildArgsForCall(1),
+				}).Should(ContainElement(&cc_messages.DesireAppRequestFromCC{
+					ProcessGuid: "new-process-guid",
+					ETag:        "new-etag",
+				}))
 			})
 
 			It("creates a desired LRP for the missing app", func() {
@@ -310,6 +329,23 @@ var _ = Describe("Processor", func() {
 				})
 			})
 
+			Context("when the built desire LRP request is invalid", func() {
+				BeforeEach(func() {
+					recipeBuilder.BuildReturns(nil, recipebuilder.ValidationError{errors.New("bad-guid")})
+				})
+
+				It("counts the invalid LRP", func() {
+					Eventually(func() uint64 {
+						return metricSender.GetCounter("LRPsDesiredInvalid")
+					}).Should(Equal(uint64(1)))
+				})
+
+				It("does not create the LRP or update the domain", func() {
+					Consistently(receptorClient.CreateDesiredLRPCallCount).Should(Equal(0))
+					Consistently(receptorClient.UpsertDomainCallCount).Should(Equal(0))
+				})
+			})
+
 			Context("when creating the missing desired LRP fails", func() {
 				BeforeEach(func() {
 					receptorClient.CreateDesiredLRPReturns(errors.New("nope"))
@@ -339,6 +375,213 @@ var _ = Describe("Processor", func() {
 			})
 		})
 
+		Context("and the differ discovers stale apps", func() {
+			It("uses the recipe builder to construct the update LRP request", func() {
+				Eventually(recipeBuilder.BuildUpdateCallCount).Should(Equal(1))
+				Ω(recipeBuilder.BuildUpdateArgsForCall(0)).Should(Equal(
+					&cc_messages.DesireAppRequestFromCC{
+						ProcessGuid: "stale-process-guid",
+						ETag:        "new-etag",
+					}))
+			})
+
+			It("updates the stale LRP", func() {
+				Eventually(receptorClient.UpdateDesiredLRPCallCount).Should(Equal(1))
+
+				processGuid, updateRequest := receptorClient.UpdateDesiredLRPArgsForCall(0)
+				Ω(processGuid).Should(Equal("stale-process-guid"))
+				Ω(*updateRequest.Annotation).Should(Equal("new-etag"))
+				Ω(updateRequest.Routes).Should(Equal(cfroutes.CFRoutes{
+					{Port: 8080},
+				}.RoutingInfo()))
+			})
+
+			Context("when the app changed in ways an update cannot apply", func() {
+				BeforeEach(func() {
+					recipeBuilder.BuildStub = func(ccRequest *cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPCreateRequest, error) {
+						return &receptor.DesiredLRPCreateRequest{
+							ProcessGuid: ccRequest.ProcessGuid,
+							Annotation:  ccRequest.ETag,
+							MemoryMB:    1024,
+						}, nil
+					}
+				})
+
+				It("replaces the LRP instead of updating it", func() {
+					Eventually(recreator.RecreateCallCount).Should(Equal(1))
+
+					_, createReq := recreator.RecreateArgsForCall(0)
+					Ω(createReq.ProcessGuid).Should(Equal("stale-process-guid"))
+					Ω(createReq.MemoryMB).Should(Equal(1024))
+
+					Consistently(receptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+				})
+
+				Context("when replacing the LRP fails", func() {
+					BeforeEach(func() {
+						recreator.RecreateReturns(errors.New("recreate failed!"))
+					})
+
+					It("does not update the domain", func() {
+						Eventually(recreator.RecreateCallCount).Should(Equal(1))
+						Consistently(receptorClient.UpsertDomainCallCount).Should(Equal(0))
+					})
+				})
+			})
+
+			Context("when building the update LRP request fails", func() {
+				BeforeEach(func() {
+					recipeBuilder.BuildUpdateReturns(nil, errors.New("nope"))
+				})
+
+				It("does not update the LRP or the domain", func() {
+					Consistently(receptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+					Consistently(receptorClient.UpsertDomainCallCount).Should(Equal(0))
+				})
+
+				It("continues to send the creates and deletes", func() {
+					Eventually(receptorClient.CreateDesiredLRPCallCount).Should(Equal(1))
+					Eventually(receptorClient.DeleteDesiredLRPCallCount).Should(Equal(1))
+				})
+			})
+
+			Context("when the update LRP request is invalid", func() {
+				BeforeEach(func() {
+					recipeBuilder.BuildUpdateReturns(nil, recipebuilder.ValidationError{errors.New("num_instances 23 exceeds the limit of 10")})
+				})
+
+				It("does not update the LRP", func() {
+					Consistently(receptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+				})
+
+				It("counts the invalid update", func() {
+					Eventually(func() uint64 {
+						return metricSender.GetCounter("LRPsDesiredInvalid")
+					}).Should(Equal(uint64(1)))
+				})
+			})
+		})
+
+		Context("and the differ discovers LRPs built by an older recipe builder", func() {
+			BeforeEach(func() {
+				fingerprintsToFetch = append(fingerprintsToFetch, cc_messages.CCDesiredAppFingerprint{
+					ProcessGuid: "outdated-process-guid",
+					ETag:        "outdated-etag",
+				})
+
+				existingDesired = append(existingDesired, receptor.DesiredLRPResponse{
+					ProcessGuid: "outdated-process-guid",
+					Annotation:  `{"etag":"outdated-etag","recipe_version":"0"}`,
+				})
+				receptorClient.DesiredLRPsByDomainReturns(existingDesired, nil)
+			})
+
+			It("rebuilds them with the current recipe builder", func() {
+				Eventually(recipeBuilder.BuildCallCount).Should(Equal(3))
+
+				built := []string{
+					recipeBuilder.BuildArgsForCall(0).ProcessGuid,
+					recipeBuilder.BuildArgsForCall(1).ProcessGuid,
+					recipeBuilder.BuildArgsForCall(2).ProcessGuid,
+				}
+				Ω(built).Should(ContainElement("outdated-process-guid"))
+			})
+
+			It("replaces them", func() {
+				Eventually(recreator.RecreateCallCount).Should(Equal(1))
+
+				_, createReq := recreator.RecreateArgsForCall(0)
+				Ω(createReq.ProcessGuid).Should(Equal("outdated-process-guid"))
+			})
+
+			It("does not update them in place", func() {
+				Eventually(receptorClient.UpsertDomainCallCount).Should(Equal(1))
+
+				Ω(receptorClient.UpdateDesiredLRPCallCount()).Should(Equal(1))
+				updatedGuid, _ := receptorClient.UpdateDesiredLRPArgsForCall(0)
+				Ω(updatedGuid).Should(Equal("stale-process-guid"))
+			})
+
+			Context("when replacing the outdated LRP fails", func() {
+				BeforeEach(func() {
+					recreator.RecreateReturns(errors.New("recreate failed!"))
+				})
+
+				It("does not update the domain", func() {
+					Eventually(recreator.RecreateCallCount).Should(Equal(1))
+					Consistently(receptorClient.UpsertDomainCallCount).Should(Equal(0))
+				})
+			})
+		})
+
+		Context("and the differ discovers LRPs from before recipes were versioned", func() {
+			BeforeEach(func() {
+				fingerprintsToFetch = append(fingerprintsToFetch, cc_messages.CCDesiredAppFingerprint{
+					ProcessGuid: "legacy-process-guid",
+					ETag:        "legacy-etag",
+				})
+
+				existingDesired = append(existingDesired, receptor.DesiredLRPResponse{
+					ProcessGuid: "legacy-process-guid",
+					Annotation:  "legacy-etag",
+					MemoryMB:    1024,
+				})
+				receptorClient.DesiredLRPsByDomainReturns(existingDesired, nil)
+
+				recipeBuilder.BuildStub = func(ccRequest *cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPCreateRequest, error) {
+					return &receptor.DesiredLRPCreateRequest{
+						ProcessGuid: ccRequest.ProcessGuid,
+						Annotation:  ccRequest.ETag,
+						MemoryMB:    1024,
+					}, nil
+				}
+			})
+
+			It("updates them in place, stamping the current annotation", func() {
+				Eventually(receptorClient.UpsertDomainCallCount).Should(Equal(1))
+
+				updated := map[string]string{}
+				for i := 0; i < receptorClient.UpdateDesiredLRPCallCount(); i++ {
+					guid, updateReq := receptorClient.UpdateDesiredLRPArgsForCall(i)
+					updated[guid] = *updateReq.Annotation
+				}
+				Ω(updated).Should(HaveKeyWithValue("legacy-process-guid", "legacy-etag"))
+			})
+
+			It("does not recreate them", func() {
+				Eventually(receptorClient.UpsertDomainCallCount).Should(Equal(1))
+
+				for i := 0; i < recreator.RecreateCallCount(); i++ {
+					_, createReq := recreator.RecreateArgsForCall(i)
+					Ω(createReq.ProcessGuid).ShouldNot(Equal("legacy-process-guid"))
+				}
+			})
+
+			Context("whose memory changed", func() {
+				BeforeEach(func() {
+					existingDesired[len(existingDesired)-1].MemoryMB = 512
+					receptorClient.DesiredLRPsByDomainReturns(existingDesired, nil)
+				})
+
+				It("recreates them instead of updating them", func() {
+					Eventually(recreator.RecreateCallCount).Should(BeNumerically(">=", 1))
+
+					recreated := []string{}
+					for i := 0; i < recreator.RecreateCallCount(); i++ {
+						_, createReq := recreator.RecreateArgsForCall(i)
+						recreated = append(recreated, createReq.ProcessGuid)
+					}
+					Ω(recreated).Should(ContainElement("legacy-process-guid"))
+
+					Eventually(receptorClient.UpsertDomainCallCount).Should(Equal(1))
+					for i := 0; i < receptorClient.UpdateDesiredLRPCallCount(); i++ {
+						guid, _ := receptorClient.UpdateDesiredLRPArgsForCall(i)
+						Ω(guid).ShouldNot(Equal("legacy-process-guid"))
+					}
+				})
+			})
+		})
+
 		Context("and the differ provides creates and deletes", func() {
 			It("sends them to the receptor and updates the domain", func() {
 				Eventually(receptorClient.CreateDesiredLRPCallCount).Should(Equal(1))
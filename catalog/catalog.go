@@ -0,0 +1,241 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/pivotal-golang/clock"
+	"github.com/pivotal-golang/lager"
+)
+
+const DefaultCheckInterval = time.Minute
+
+// A Bundle is a lifecycle bundle that containers download from the file
+// server.
+type Bundle struct {
+	Lifecycle string `json:"lifecycle"`
+	Stack     string `json:"stack,omitempty"`
+	Path      string `json:"path"`
+	URL       string `json:"url"`
+
+	Available bool      `json:"available"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type MissingBundlesError struct {
+	URLs []string
+}
+
+func (e MissingBundlesError) Error() string {
+	return fmt.Sprintf("lifecycle bundles missing from the file server: %v", e.URLs)
+}
+
+// ResolveBundles lists the bundles of the buildpack lifecycle by stack,
+// followed by the docker lifecycle's bundle when it has one.
+func ResolveBundles(lifecycles map[string]string, dockerLifecyclePath, fileServerURL string) []Bundle {
+	stacks := make([]string, 0, len(lifecycles))
+	for stack := range lifecycles {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	bundles := []Bundle{}
+	for _, stack := range stacks {
+		bundles = append(bundles, Bundle{
+			Lifecycle: recipebuilder.BuildpackLifecycleName,
+			Stack:     stack,
+			Path:      lifecycles[stack],
+			URL:       recipebuilder.LifecycleDownloadURL(lifecycles[stack], fileServerURL),
+		})
+	}
+
+	if dockerLifecyclePath != "" {
+		bundles = append(bundles, Bundle{
+			Lifecycle: recipebuilder.DockerLifecycleName,
+			Path:      dockerLifecyclePath,
+			URL:       recipebuilder.LifecycleDownloadURL(dockerLifecyclePath, fileServerURL),
+		})
+	}
+
+	return bundles
+}
+
+// BundlesFor lists every bundle a recipe builder with the config downloads:
+// those of its enabled lifecycles, including the bundles of aliased stacks,
+// then the SSH daemon's.
+func BundlesFor(config recipebuilder.Config) []Bundle {
+	var buildpackLifecycles map[string]string
+	if config.LifecycleEnabled(recipebuilder.BuildpackLifecycleName) {
+		buildpackLifecycles = config.StackAliases.Lifecycles(config.Lifecycles)
+	}
+
+	dockerLifecyclePath := ""
+	if config.LifecycleEnabled(recipebuilder.DockerLifecycleName) {
+		dockerLifecyclePath = config.DockerLifecyclePath
+	}
+
+	bundles := ResolveBundles(buildpackLifecycles, dockerLifecyclePath, config.FileServerURL)
+
+	if config.SSH.Enabled {
+		bundles = append(bundles, Bundle{
+			Lifecycle: "ssh",
+			Path:      config.SSH.DaemonPath,
+			URL:       recipebuilder.LifecycleDownloadURL(config.SSH.DaemonPath, config.FileServerURL),
+		})
+	}
+
+	return bundles
+}
+
+// A Catalog checks that every lifecycle bundle can be downloaded. It is only
+// ready once all of them can, and keeps checking on an interval afterwards;
+// later failures are logged and reported by its handlers rather than exiting.
+type Catalog struct {
+	httpClient *http.Client
+	interval   time.Duration
+	clock      clock.Clock
+	logger     lager.Logger
+
+	lock     sync.RWMutex
+	bundles  []Bundle
+	checkErr error
+}
+
+func New(bundles []Bundle, httpClient *http.Client, interval time.Duration, clock clock.Clock, logger lager.Logger) *Catalog {
+	return &Catalog{
+		httpClient: httpClient,
+		interval:   interval,
+		clock:      clock,
+		logger:     logger.Session("lifecycle-catalog"),
+		bundles:    bundles,
+	}
+}
+
+func (c *Catalog) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	err := c.check()
+	if err != nil {
+		return err
+	}
+
+	close(ready)
+
+	timer := c.clock.NewTimer(c.interval)
+	for {
+		select {
+		case <-signals:
+			return nil
+		case <-timer.C():
+			err := c.check()
+			if err != nil {
+				c.logger.Error("check-failed", err)
+			}
+			timer.Reset(c.interval)
+		}
+	}
+}
+
+// Bundles returns the bundles as of the last check.
+func (c *Catalog) Bundles() []Bundle {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	bundles := make([]Bundle, len(c.bundles))
+	copy(bundles, c.bundles)
+	return bundles
+}
+
+// Err returns the error of the last check, if any bundle was missing.
+func (c *Catalog) Err() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.checkErr
+}
+
+// ServeHTTP serves the catalog as JSON, for the debug server. It responds
+// with 503 when the last check found a bundle missing.
+func (c *Catalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.lock.RLock()
+	bundles := make([]Bundle, len(c.bundles))
+	copy(bundles, c.bundles)
+	checkErr := c.checkErr
+	c.lock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if checkErr != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(bundles)
+}
+
+// ReadinessHandler responds with 200 while every bundle was found by the last
+// check, and with 503 and the error otherwise.
+func (c *Catalog) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := c.Err()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (c *Catalog) check() error {
+	bundles := c.Bundles()
+	missing := []string{}
+
+	for i := range bundles {
+		bundle := &bundles[i]
+
+		err := c.head(bundle.URL)
+		bundle.Available = err == nil
+		bundle.CheckedAt = c.clock.Now()
+		bundle.Error = ""
+
+		if err != nil {
+			bundle.Error = err.Error()
+			missing = append(missing, bundle.URL)
+
+			c.logger.Error("missing-lifecycle-bundle", err, lager.Data{
+				"lifecycle": bundle.Lifecycle,
+				"stack":     bundle.Stack,
+				"url":       bundle.URL,
+			})
+		}
+	}
+
+	var err error
+	if len(missing) > 0 {
+		err = MissingBundlesError{URLs: missing}
+	}
+
+	c.lock.Lock()
+	c.bundles = bundles
+	c.checkErr = err
+	c.lock.Unlock()
+
+	return err
+}
+
+func (c *Catalog) head(url string) error {
+	resp, err := c.httpClient.Head(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
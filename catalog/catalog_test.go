@@ -0,0 +1,247 @@
+package catalog_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/catalog"
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-golang/clock/fakeclock"
+	"github.com/pivotal-golang/lager/lagertest"
+	"github.com/tedsuo/ifrit"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Catalog", func() {
+	Describe("ResolveBundles", func() {
+		It("lists the buildpack bundles by stack, then the docker bundle", func() {
+			bundles := catalog.ResolveBundles(map[string]string{
+				"stack-b": "b-lifecycle.tgz",
+				"stack-a": "a-lifecycle.tgz",
+			}, "docker-lifecycle.tgz", "http://file-server.com")
+
+			Ω(bundles).Should(Equal([]catalog.Bundle{
+				{Lifecycle: "buildpack", Stack: "stack-a", Path: "a-lifecycle.tgz", URL: "http://file-server.com/v1/static/a-lifecycle.tgz"},
+				{Lifecycle: "buildpack", Stack: "stack-b", Path: "b-lifecycle.tgz", URL: "http://file-server.com/v1/static/b-lifecycle.tgz"},
+				{Lifecycle: "docker", Path: "docker-lifecycle.tgz", URL: "http://file-server.com/v1/static/docker-lifecycle.tgz"},
+			}))
+		})
+
+		It("leaves out the docker bundle when there is none", func() {
+			bundles := catalog.ResolveBundles(map[string]string{"stack-a": "a-lifecycle.tgz"}, "", "http://file-server.com")
+			Ω(bundles).Should(HaveLen(1))
+		})
+	})
+
+	Describe("BundlesFor", func() {
+		var config recipebuilder.Config
+
+		BeforeEach(func() {
+			config = recipebuilder.Config{
+				Lifecycles:          map[string]string{"stack-a": "a-lifecycle.tgz"},
+				DockerLifecyclePath: "docker-lifecycle.tgz",
+				FileServerURL:       "http://file-server.com",
+			}
+		})
+
+		It("lists the bundles of every lifecycle by default", func() {
+			Ω(catalog.BundlesFor(config)).Should(HaveLen(2))
+		})
+
+		It("leaves out the bundles of disabled lifecycles", func() {
+			config.EnabledLifecycles = []string{recipebuilder.DockerLifecycleName}
+
+			Ω(catalog.BundlesFor(config)).Should(Equal([]catalog.Bundle{
+				{Lifecycle: "docker", Path: "docker-lifecycle.tgz", URL: "http://file-server.com/v1/static/docker-lifecycle.tgz"},
+			}))
+		})
+
+		It("lists the bundles of aliased stacks", func() {
+			config.StackAliases = recipebuilder.StackAliases{
+				"old-stack": {Stack: "stack-a", Lifecycle: "old-lifecycle.tgz"},
+			}
+
+			Ω(catalog.BundlesFor(config)).Should(ContainElement(catalog.Bundle{
+				Lifecycle: "buildpack",
+				Stack:     "old-stack",
+				Path:      "old-lifecycle.tgz",
+				URL:       "http://file-server.com/v1/static/old-lifecycle.tgz",
+			}))
+		})
+
+		It("adds the SSH daemon's bundle when ssh is enabled", func() {
+			config.SSH = recipebuilder.SSHConfig{Enabled: true, DaemonPath: "diego-sshd.tgz"}
+
+			bundles := catalog.BundlesFor(config)
+			Ω(bundles).Should(HaveLen(3))
+			Ω(bundles[2]).Should(Equal(catalog.Bundle{
+				Lifecycle: "ssh",
+				Path:      "diego-sshd.tgz",
+				URL:       "http://file-server.com/v1/static/diego-sshd.tgz",
+			}))
+		})
+	})
+
+	Describe("running", func() {
+		var (
+			fileServer *ghttp.Server
+			clock      *fakeclock.FakeClock
+			subject    *catalog.Catalog
+			process    ifrit.Process
+			logger     *lagertest.TestLogger
+
+			dockerStatus int
+		)
+
+		BeforeEach(func() {
+			fileServer = ghttp.NewServer()
+			fileServer.AllowUnhandledRequests = true
+
+			dockerStatus = http.StatusOK
+			fileServer.RouteToHandler("HEAD", "/v1/static/a-lifecycle.tgz", ghttp.RespondWith(http.StatusOK, nil))
+			fileServer.RouteToHandler("HEAD", "/v1/static/docker-lifecycle.tgz", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(dockerStatus)
+			})
+
+			clock = fakeclock.NewFakeClock(time.Now())
+			logger = lagertest.NewTestLogger("test")
+		})
+
+		JustBeforeEach(func() {
+			bundles := catalog.ResolveBundles(
+				map[string]string{"stack-a": "a-lifecycle.tgz"},
+				"docker-lifecycle.tgz",
+				fileServer.URL(),
+			)
+
+			subject = catalog.New(bundles, http.DefaultClient, time.Minute, clock, logger)
+			process = ifrit.Background(subject)
+		})
+
+		AfterEach(func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+			fileServer.Close()
+		})
+
+		Context("when every bundle is on the file server", func() {
+			It("becomes ready", func() {
+				Eventually(process.Ready()).Should(BeClosed())
+			})
+
+			It("records when each bundle was found", func() {
+				Eventually(process.Ready()).Should(BeClosed())
+
+				for _, bundle := range subject.Bundles() {
+					Ω(bundle.Available).Should(BeTrue())
+					Ω(bundle.CheckedAt).Should(Equal(clock.Now()))
+				}
+			})
+
+			It("serves the catalog as json", func() {
+				Eventually(process.Ready()).Should(BeClosed())
+
+				recorder := httptest.NewRecorder()
+				subject.ServeHTTP(recorder, nil)
+
+				bundles := []catalog.Bundle{}
+				err := json.Unmarshal(recorder.Body.Bytes(), &bundles)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(bundles).Should(HaveLen(2))
+				Ω(bundles[1].Lifecycle).Should(Equal("docker"))
+			})
+
+			Context("when a bundle disappears later", func() {
+				It("marks it unavailable on the next check without exiting", func() {
+					Eventually(process.Ready()).Should(BeClosed())
+
+					dockerStatus = http.StatusNotFound
+					clock.Increment(time.Minute)
+
+					Eventually(func() bool {
+						return subject.Bundles()[1].Available
+					}).Should(BeFalse())
+					Consistently(process.Wait()).ShouldNot(Receive())
+				})
+
+				It("logs the failed check", func() {
+					Eventually(process.Ready()).Should(BeClosed())
+
+					dockerStatus = http.StatusNotFound
+					clock.Increment(time.Minute)
+
+					Eventually(logger).Should(gbytes.Say("check-failed"))
+				})
+
+				It("reports the missing bundle through readiness and the catalog", func() {
+					Eventually(process.Ready()).Should(BeClosed())
+
+					recorder := httptest.NewRecorder()
+					subject.ReadinessHandler().ServeHTTP(recorder, nil)
+					Ω(recorder.Code).Should(Equal(http.StatusOK))
+
+					dockerStatus = http.StatusNotFound
+					clock.Increment(time.Minute)
+
+					Eventually(subject.Err).Should(MatchError(catalog.MissingBundlesError{
+						URLs: []string{fileServer.URL() + "/v1/static/docker-lifecycle.tgz"},
+					}))
+
+					recorder = httptest.NewRecorder()
+					subject.ReadinessHandler().ServeHTTP(recorder, nil)
+					Ω(recorder.Code).Should(Equal(http.StatusServiceUnavailable))
+					Ω(recorder.Body.String()).Should(ContainSubstring("docker-lifecycle.tgz"))
+
+					recorder = httptest.NewRecorder()
+					subject.ServeHTTP(recorder, nil)
+					Ω(recorder.Code).Should(Equal(http.StatusServiceUnavailable))
+
+					bundles := []catalog.Bundle{}
+					err := json.Unmarshal(recorder.Body.Bytes(), &bundles)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(bundles[1].Available).Should(BeFalse())
+					Ω(bundles[1].Error).Should(Equal("unexpected status 404"))
+				})
+
+				Context("and comes back", func() {
+					It("reports ready again", func() {
+						Eventually(process.Ready()).Should(BeClosed())
+
+						dockerStatus = http.StatusNotFound
+						clock.Increment(time.Minute)
+						Eventually(subject.Err).Should(HaveOccurred())
+
+						dockerStatus = http.StatusOK
+						Eventually(func() error {
+							clock.Increment(time.Minute)
+							return subject.Err()
+						}).ShouldNot(HaveOccurred())
+					})
+				})
+			})
+		})
+
+		Context("when a bundle is missing", func() {
+			BeforeEach(func() {
+				dockerStatus = http.StatusNotFound
+			})
+
+			It("exits without becoming ready", func() {
+				var err error
+				Eventually(process.Wait()).Should(Receive(&err))
+				Ω(err).Should(MatchError(catalog.MissingBundlesError{
+					URLs: []string{fileServer.URL() + "/v1/static/docker-lifecycle.tgz"},
+				}))
+
+				Ω(process.Ready()).ShouldNot(BeClosed())
+			})
+		})
+	})
+})
@@ -1,9 +1,8 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
 	"flag"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -22,10 +21,14 @@ import (
 	"github.com/pivotal-golang/lager"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/http_server"
 	"github.com/tedsuo/ifrit/sigmon"
 
 	"github.com/cloudfoundry-incubator/nsync/bulk"
+	"github.com/cloudfoundry-incubator/nsync/catalog"
 	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/nsync/recipeflags"
+	"github.com/cloudfoundry-incubator/nsync/recreator"
 )
 
 var etcdCluster = flag.String(
@@ -64,6 +67,24 @@ var ccPassword = flag.String(
 	"basic auth password for CC bulk API",
 )
 
+var maxConcurrentRecreates = flag.Int(
+	"maxConcurrentRecreates",
+	recreator.DefaultMaxInFlight,
+	"maximum number of LRPs this process replaces at once because of changes that cannot be updated in place; every instance of a replaced LRP stops until the new LRP starts",
+)
+
+var recreateInterval = flag.Duration(
+	"recreateInterval",
+	recreator.DefaultInterval,
+	"minimum interval between starting two LRP replacements in this process",
+)
+
+var lifecycleCheckInterval = flag.Duration(
+	"lifecycleCheckInterval",
+	catalog.DefaultCheckInterval,
+	"interval between checks that every lifecycle bundle is on the file server",
+)
+
 var communicationTimeout = flag.Duration(
 	"communicationTimeout",
 	30*time.Second,
@@ -94,24 +115,6 @@ var skipCertVerify = flag.Bool(
 	"skip SSL certificate verification",
 )
 
-var lifecycles = flag.String(
-	"lifecycles",
-	"",
-	"app lifecycle binary bundle mapping (stack => bundle filename in fileserver)",
-)
-
-var dockerLifecyclePath = flag.String(
-	"dockerLifecyclePath",
-	"",
-	"path for downloading docker lifecycle from file server",
-)
-
-var fileServerURL = flag.String(
-	"fileServerURL",
-	"",
-	"URL of the file server",
-)
-
 const (
 	dropsondeOrigin      = "nsync_bulker"
 	dropsondeDestination = "localhost:3457"
@@ -120,6 +123,7 @@ const (
 func main() {
 	cf_debug_server.AddFlags(flag.CommandLine)
 	cf_lager.AddFlags(flag.CommandLine)
+	recipeFlags := recipeflags.AddFlags(flag.CommandLine)
 	flag.Parse()
 
 	cf_http.Initialize(*communicationTimeout)
@@ -135,17 +139,12 @@ func main() {
 		logger.Fatal("Couldn't generate uuid", err)
 	}
 
-	var lifecycleDownloadURLs map[string]string
-	err = json.Unmarshal([]byte(*lifecycles), &lifecycleDownloadURLs)
+	recipeBuilderConfig, err := recipeFlags.Config()
 	if err != nil {
-		logger.Fatal("invalid-lifecycle-mapping", err)
+		logger.Fatal("invalid-recipe-builder-flags", err)
 	}
 
-	if *dockerLifecyclePath == "" {
-		logger.Fatal("empty-docker_app_lifecycle-path", errors.New("dockerLifecyclePath flag not provided"))
-	}
-
-	recipeBuilder := recipebuilder.New(lifecycleDownloadURLs, *dockerLifecyclePath, *fileServerURL, logger)
+	recipeBuilder := recipebuilder.New(recipeBuilderConfig, logger)
 
 	heartbeater := bbs.NewNsyncBulkerLock(uuid.String(), *heartbeatInterval)
 
@@ -163,17 +162,27 @@ func main() {
 			Password:  *ccPassword,
 		},
 		recipeBuilder,
+		recreator.New(diegoAPIClient, *maxConcurrentRecreates, *recreateInterval, clock.NewClock()),
+		clock.NewClock(),
+	)
+
+	lifecycleCatalog := catalog.New(
+		catalog.BundlesFor(recipeBuilderConfig),
+		cf_http.NewClient(),
+		*lifecycleCheckInterval,
 		clock.NewClock(),
+		logger,
 	)
 
 	members := grouper.Members{
 		{"heartbeater", heartbeater},
+		{"lifecycle-catalog", lifecycleCatalog},
 		{"runner", runner},
 	}
 
 	if dbgAddr := cf_debug_server.DebugAddress(flag.CommandLine); dbgAddr != "" {
 		members = append(grouper.Members{
-			{"debug-server", cf_debug_server.Runner(dbgAddr, reconfigurableSink)},
+			{"debug-server", debugServer(dbgAddr, reconfigurableSink, lifecycleCatalog)},
 		}, members...)
 	}
 
@@ -195,6 +204,17 @@ func main() {
 	os.Exit(0)
 }
 
+// debugServer serves the lifecycle catalog and its readiness alongside the
+// usual debug endpoints.
+func debugServer(address string, sink *lager.ReconfigurableSink, lifecycleCatalog *catalog.Catalog) ifrit.Runner {
+	mux := http.NewServeMux()
+	mux.Handle("/", cf_debug_server.Handler(sink))
+	mux.Handle("/lifecycles", lifecycleCatalog)
+	mux.Handle("/ready", lifecycleCatalog.ReadinessHandler())
+
+	return http_server.New(address, mux)
+}
+
 func initializeDropsonde(logger lager.Logger) {
 	err := dropsonde.Initialize(dropsondeDestination, dropsondeOrigin)
 	if err != nil {
@@ -32,6 +32,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 	var (
 		bbs            *Bbs.BBS
 		fakeCC         *ghttp.Server
+		fileServer     *ghttp.Server
 		receptorClient receptor.Client
 
 		receptorProcess ifrit.Process
@@ -67,7 +68,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 				"-bulkBatchSize", "10",
 				"-lifecycles", `{"some-stack": "some-health-check.tar.gz"}`,
 				"-dockerLifecyclePath", "the/docker/lifecycle/path.tgz",
-				"-fileServerURL", "http://file-server.com",
+				"-fileServerURL", fileServer.URL(),
 				"-heartbeatInterval", heartbeatInterval.String(),
 				"-diegoAPIURL", fmt.Sprintf("http://127.0.0.1:%d", receptorPort),
 			),
@@ -91,6 +92,10 @@ var _ = Describe("Syncing desired state with CC", func() {
 		bbs = Bbs.NewBBS(etcdClient, clock.NewClock(), logger)
 
 		fakeCC = ghttp.NewServer()
+
+		fileServer = ghttp.NewServer()
+		fileServer.RouteToHandler("HEAD", "/v1/static/some-health-check.tar.gz", ghttp.RespondWith(200, nil))
+		fileServer.RouteToHandler("HEAD", "/v1/static/the/docker/lifecycle/path.tgz", ghttp.RespondWith(200, nil))
 		receptorProcess = startReceptor()
 
 		receptorClient = receptor.NewClient(fmt.Sprintf("http://127.0.0.1:%d", receptorPort))
@@ -180,6 +185,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 
 	AfterEach(func() {
 		defer fakeCC.Close()
+		defer fileServer.Close()
 		ginkgomon.Interrupt(receptorProcess)
 	})
 
@@ -233,12 +239,11 @@ var _ = Describe("Syncing desired state with CC", func() {
 			}`), &existing2)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			builder := recipebuilder.New(
-				map[string]string{"some-stack": "some-health-check.tar.gz"},
-				"the/docker/lifecycle/path.tgz",
-				"http://file-server.com",
-				lagertest.NewTestLogger("test"),
-			)
+			builder := recipebuilder.New(recipebuilder.Config{
+				Lifecycles:          map[string]string{"some-stack": "some-health-check.tar.gz"},
+				DockerLifecyclePath: "the/docker/lifecycle/path.tgz",
+				FileServerURL:       fileServer.URL(),
+			}, lagertest.NewTestLogger("test"))
 
 			desired1, err = builder.Build(&existing1)
 			Ω(err).ShouldNot(HaveOccurred())
@@ -272,7 +277,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 
 				expectedSetupActions1 := models.Serial(
 					&models.DownloadAction{
-						From:     "http://file-server.com/v1/static/some-health-check.tar.gz",
+						From:     fileServer.URL() + "/v1/static/some-health-check.tar.gz",
 						To:       "/tmp/lifecycle",
 						CacheKey: "",
 					},
@@ -285,7 +290,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 
 				expectedSetupActions2 := models.Serial(
 					&models.DownloadAction{
-						From:     "http://file-server.com/v1/static/some-health-check.tar.gz",
+						From:     fileServer.URL() + "/v1/static/some-health-check.tar.gz",
 						To:       "/tmp/lifecycle",
 						CacheKey: "",
 					},
@@ -298,7 +303,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 
 				expectedSetupActions3 := models.Serial(
 					&models.DownloadAction{
-						From:     "http://file-server.com/v1/static/some-health-check.tar.gz",
+						From:     fileServer.URL() + "/v1/static/some-health-check.tar.gz",
 						To:       "/tmp/lifecycle",
 						CacheKey: "",
 					},
@@ -340,6 +345,8 @@ var _ = Describe("Syncing desired state with CC", func() {
 							{Name: "env-key-1", Value: "env-value-1"},
 							{Name: "env-key-2", Value: "env-value-2"},
 							{Name: "PORT", Value: "8080"},
+							{Name: "MEMORY_LIMIT", Value: "256m"},
+							{Name: "PROCESS_GUID", Value: "process-guid-1"},
 						},
 						ResourceLimits: models.ResourceLimits{Nofile: &nofile},
 						LogSource:      recipebuilder.AppLogSource,
@@ -363,8 +370,8 @@ var _ = Describe("Syncing desired state with CC", func() {
 					LogGuid:     "log-guid-1",
 					LogSource:   recipebuilder.LRPLogSource,
 					MetricsGuid: "log-guid-1",
-					Privileged:  true,
-					Annotation:  "1.1",
+					Privileged:  false,
+					Annotation:  recipebuilder.NewAnnotation("1.1").String(),
 				}))
 
 				nofile = 16
@@ -386,6 +393,8 @@ var _ = Describe("Syncing desired state with CC", func() {
 							{Name: "env-key-1", Value: "env-value-1"},
 							{Name: "env-key-2", Value: "env-value-2"},
 							{Name: "PORT", Value: "8080"},
+							{Name: "MEMORY_LIMIT", Value: "256m"},
+							{Name: "PROCESS_GUID", Value: "process-guid-2"},
 						},
 						ResourceLimits: models.ResourceLimits{Nofile: &nofile},
 						LogSource:      recipebuilder.AppLogSource,
@@ -409,8 +418,8 @@ var _ = Describe("Syncing desired state with CC", func() {
 					LogGuid:     "log-guid-1",
 					LogSource:   recipebuilder.LRPLogSource,
 					MetricsGuid: "log-guid-1",
-					Privileged:  true,
-					Annotation:  "2.1",
+					Privileged:  false,
+					Annotation:  recipebuilder.NewAnnotation("2.1").String(),
 				}))
 
 				nofile = 8
@@ -430,6 +439,8 @@ var _ = Describe("Syncing desired state with CC", func() {
 						Args: []string{"/app", "start-command-3", "execution-metadata-3"},
 						Env: []models.EnvironmentVariable{
 							{Name: "PORT", Value: "8080"},
+							{Name: "MEMORY_LIMIT", Value: "128m"},
+							{Name: "PROCESS_GUID", Value: "process-guid-3"},
 						},
 						ResourceLimits: models.ResourceLimits{Nofile: &nofile},
 						LogSource:      recipebuilder.AppLogSource,
@@ -453,8 +464,8 @@ var _ = Describe("Syncing desired state with CC", func() {
 					LogGuid:     "log-guid-3",
 					LogSource:   recipebuilder.LRPLogSource,
 					MetricsGuid: "log-guid-3",
-					Privileged:  true,
-					Annotation:  "3.1",
+					Privileged:  false,
+					Annotation:  recipebuilder.NewAnnotation("3.1").String(),
 				}))
 			})
 
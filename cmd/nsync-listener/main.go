@@ -1,9 +1,8 @@
 package main
 
 import (
-	"encoding/json"
-	"errors"
 	"flag"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -22,10 +21,15 @@ import (
 	"github.com/pivotal-golang/lager"
 	"github.com/tedsuo/ifrit"
 	"github.com/tedsuo/ifrit/grouper"
+	"github.com/tedsuo/ifrit/http_server"
 	"github.com/tedsuo/ifrit/sigmon"
 
+	"github.com/cloudfoundry-incubator/nsync/catalog"
+	"github.com/cloudfoundry-incubator/nsync/deadletter"
 	"github.com/cloudfoundry-incubator/nsync/listen"
 	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/nsync/recipeflags"
+	"github.com/cloudfoundry-incubator/nsync/recreator"
 	"github.com/cloudfoundry/dropsonde"
 )
 
@@ -65,22 +69,64 @@ var natsPassword = flag.String(
 	"Password for nats user",
 )
 
-var lifecycles = flag.String(
-	"lifecycles",
-	"",
-	"app lifecycle binary bundle mapping (stack => bundle filename in fileserver)",
+var maxConcurrentMessages = flag.Int(
+	"maxConcurrentMessages",
+	listen.DefaultMaxInFlight,
+	"maximum number of process guids whose messages are handled at once",
 )
 
-var dockerLifecyclePath = flag.String(
-	"dockerLifecyclePath",
-	"",
-	"path for downloading docker lifecycle from file server",
+var intakeSize = flag.Int(
+	"intakeSize",
+	listen.DefaultIntakeSize,
+	"maximum number of received messages waiting in the intake, and of messages queued behind another for their process guid",
+)
+
+var overflowPolicy = flag.String(
+	"overflowPolicy",
+	string(listen.DefaultOverflowPolicy),
+	"what to do with messages once the intake is full: block, drop-oldest or drop-newest",
+)
+
+var maxRetryAttempts = flag.Int(
+	"maxRetryAttempts",
+	listen.DefaultMaxAttempts,
+	"attempts at a receptor operation that fails with transient errors",
+)
+
+var initialRetryDelay = flag.Duration(
+	"initialRetryDelay",
+	listen.DefaultInitialRetryDelay,
+	"backoff before the first retry of a receptor operation",
 )
 
-var fileServerURL = flag.String(
-	"fileServerURL",
+var maxRetryDelay = flag.Duration(
+	"maxRetryDelay",
+	listen.DefaultMaxRetryDelay,
+	"longest backoff between retries of a receptor operation",
+)
+
+var deadLetterFile = flag.String(
+	"deadLetterFile",
 	"",
-	"URL of the file server",
+	"path to the file recording messages whose operations failed (see nsync-replay)",
+)
+
+var maxConcurrentRecreates = flag.Int(
+	"maxConcurrentRecreates",
+	recreator.DefaultMaxInFlight,
+	"maximum number of LRPs this process replaces at once because of changes that cannot be updated in place; every instance of a replaced LRP stops until the new LRP starts",
+)
+
+var recreateInterval = flag.Duration(
+	"recreateInterval",
+	recreator.DefaultInterval,
+	"minimum interval between starting two LRP replacements in this process",
+)
+
+var lifecycleCheckInterval = flag.Duration(
+	"lifecycleCheckInterval",
+	catalog.DefaultCheckInterval,
+	"interval between checks that every lifecycle bundle is on the file server",
 )
 
 var communicationTimeout = flag.Duration(
@@ -97,6 +143,7 @@ const (
 func main() {
 	cf_debug_server.AddFlags(flag.CommandLine)
 	cf_lager.AddFlags(flag.CommandLine)
+	recipeFlags := recipeflags.AddFlags(flag.CommandLine)
 	flag.Parse()
 
 	cf_http.Initialize(*communicationTimeout)
@@ -107,18 +154,12 @@ func main() {
 	diegoAPIClient := receptor.NewClient(*diegoAPIURL)
 	bbs := initializeBbs(logger)
 
-	var lifecycleDownloadURLs map[string]string
-	err := json.Unmarshal([]byte(*lifecycles), &lifecycleDownloadURLs)
-
-	if *dockerLifecyclePath == "" {
-		logger.Fatal("empty-docker_app_lifecycle-path", errors.New("dockerLifecyclePath flag not provided"))
-	}
-
+	recipeBuilderConfig, err := recipeFlags.Config()
 	if err != nil {
-		logger.Fatal("invalid-lifecycle-mapping", err)
+		logger.Fatal("invalid-recipe-builder-flags", err)
 	}
 
-	recipeBuilder := recipebuilder.New(lifecycleDownloadURLs, *dockerLifecyclePath, *fileServerURL, logger)
+	recipeBuilder := recipebuilder.New(recipeBuilderConfig, logger)
 
 	uuid, err := uuid.NewV4()
 	if err != nil {
@@ -128,22 +169,52 @@ func main() {
 	nsyncLock := bbs.NewNsyncListenerLock(uuid.String(), *heartbeatInterval)
 	natsClient := diegonats.NewClient()
 	natsClientRunner := diegonats.NewClientRunner(*natsAddresses, *natsUsername, *natsPassword, logger, natsClient)
+
+	overflow, err := listen.ParseOverflowPolicy(*overflowPolicy)
+	if err != nil {
+		logger.Fatal("invalid-overflow-policy", err)
+	}
+
+	var deadLetters deadletter.Journal
+	if *deadLetterFile != "" {
+		deadLetters = deadletter.NewJournal(*deadLetterFile)
+	}
+
 	listener := listen.Listen{
 		NATSClient:     natsClient,
 		ReceptorClient: diegoAPIClient,
+		Recreator:      recreator.New(diegoAPIClient, *maxConcurrentRecreates, *recreateInterval, clock.NewClock()),
 		Logger:         logger,
 		RecipeBuilder:  recipeBuilder,
+		MaxInFlight:    *maxConcurrentMessages,
+		IntakeSize:     *intakeSize,
+		OverflowPolicy: overflow,
+		Retry: listen.RetryPolicy{
+			MaxAttempts:  *maxRetryAttempts,
+			InitialDelay: *initialRetryDelay,
+			MaxDelay:     *maxRetryDelay,
+		},
+		DeadLetters: deadLetters,
 	}
 
+	lifecycleCatalog := catalog.New(
+		catalog.BundlesFor(recipeBuilderConfig),
+		cf_http.NewClient(),
+		*lifecycleCheckInterval,
+		clock.NewClock(),
+		logger,
+	)
+
 	members := grouper.Members{
 		{"nsyncLock", nsyncLock},
 		{"nats-client", natsClientRunner},
+		{"lifecycle-catalog", lifecycleCatalog},
 		{"listener", listener},
 	}
 
 	if dbgAddr := cf_debug_server.DebugAddress(flag.CommandLine); dbgAddr != "" {
 		members = append(grouper.Members{
-			{"debug-server", cf_debug_server.Runner(dbgAddr, reconfigurableSink)},
+			{"debug-server", debugServer(dbgAddr, reconfigurableSink, lifecycleCatalog)},
 		}, members...)
 	}
 
@@ -164,6 +235,17 @@ func main() {
 	logger.Info("exited")
 }
 
+// debugServer serves the lifecycle catalog and its readiness alongside the
+// usual debug endpoints.
+func debugServer(address string, sink *lager.ReconfigurableSink, lifecycleCatalog *catalog.Catalog) ifrit.Runner {
+	mux := http.NewServeMux()
+	mux.Handle("/", cf_debug_server.Handler(sink))
+	mux.Handle("/lifecycles", lifecycleCatalog)
+	mux.Handle("/ready", lifecycleCatalog.ReadinessHandler())
+
+	return http_server.New(address, mux)
+}
+
 func initializeDropsonde(logger lager.Logger) {
 	err := dropsonde.Initialize(dropsondeDestination, dropsondeOrigin)
 	if err != nil {
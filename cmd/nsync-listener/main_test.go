@@ -13,6 +13,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/ghttp"
 	"github.com/pivotal-golang/clock"
 	"github.com/pivotal-golang/lager/lagertest"
 	"github.com/tedsuo/ifrit"
@@ -31,6 +32,8 @@ var _ = Describe("Syncing desired state with CC", func() {
 		process ifrit.Process
 
 		etcdAdapter storeadapter.StoreAdapter
+
+		fileServer *ghttp.Server
 	)
 
 	startNATS := func() {
@@ -60,7 +63,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 				"-natsAddresses", fmt.Sprintf("127.0.0.1:%d", natsPort),
 				"-lifecycles", `{"some-stack": "some-health-check.tar.gz"}`,
 				"-dockerLifecyclePath", "the/docker/lifecycle/path.tgz",
-				"-fileServerURL", "http://file-server.com",
+				"-fileServerURL", fileServer.URL(),
 				"-heartbeatInterval", "1s",
 				"-logLevel", "debug",
 			),
@@ -68,6 +71,10 @@ var _ = Describe("Syncing desired state with CC", func() {
 	}
 
 	BeforeEach(func() {
+		fileServer = ghttp.NewServer()
+		fileServer.RouteToHandler("HEAD", "/v1/static/some-health-check.tar.gz", ghttp.RespondWith(200, nil))
+		fileServer.RouteToHandler("HEAD", "/v1/static/the/docker/lifecycle/path.tgz", ghttp.RespondWith(200, nil))
+
 		etcdAdapter = etcdRunner.Adapter()
 		bbs = Bbs.NewBBS(etcdAdapter, clock.NewClock(), lagertest.NewTestLogger("test"))
 		receptorProcess = startReceptor()
@@ -75,6 +82,7 @@ var _ = Describe("Syncing desired state with CC", func() {
 	})
 
 	AfterEach(func() {
+		fileServer.Close()
 		etcdAdapter.Disconnect()
 		ginkgomon.Interrupt(receptorProcess, 2*time.Second)
 	})
@@ -172,6 +180,23 @@ var _ = Describe("Syncing desired state with CC", func() {
 				})
 			})
 		})
+
+		Context("and a lifecycle bundle is missing from the file server", func() {
+			BeforeEach(func() {
+				fileServer.RouteToHandler("HEAD", "/v1/static/some-health-check.tar.gz", ghttp.RespondWith(404, nil))
+
+				process = ifrit.Background(runner)
+			})
+
+			AfterEach(func() {
+				ginkgomon.Interrupt(process, 2*time.Second)
+			})
+
+			It("refuses to start", func() {
+				Eventually(process.Wait(), 5*time.Second).Should(Receive(HaveOccurred()))
+				Ω(process.Ready()).ShouldNot(BeClosed())
+			})
+		})
 	})
 
 	Describe("when NATS is not up", func() {
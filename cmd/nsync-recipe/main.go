@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/nsync/recipeflags"
+)
+
+var verbose = flag.Bool(
+	"verbose",
+	false,
+	"log the recipe builder's decisions to stderr",
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [desire-app-request.json]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Renders the desired LRP create request for a CC desire app message read from the file, or from stdin.")
+		fmt.Fprintln(os.Stderr, "Takes the same recipe builder flags as the listener and bulker.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	recipeFlags := recipeflags.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger := lager.NewLogger("nsync-recipe")
+	if *verbose {
+		logger.RegisterSink(lager.NewWriterSink(os.Stderr, lager.DEBUG))
+	}
+
+	config, err := recipeFlags.Config()
+	if err != nil {
+		fail("%s", err)
+	}
+
+	desiredApp, err := readDesireAppRequest(flag.Arg(0))
+	if err != nil {
+		fail("failed to read desire app request: %s", err)
+	}
+
+	builder := recipebuilder.New(config, logger)
+
+	desiredLRP, err := builder.Build(&desiredApp)
+	if err != nil {
+		fail("failed to build recipe: %s", err)
+	}
+
+	output, err := json.MarshalIndent(desiredLRP, "", "  ")
+	if err != nil {
+		fail("failed to encode desired LRP: %s", err)
+	}
+
+	fmt.Println(string(output))
+}
+
+func readDesireAppRequest(path string) (cc_messages.DesireAppRequestFromCC, error) {
+	var source io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return cc_messages.DesireAppRequestFromCC{}, err
+		}
+		defer file.Close()
+
+		source = file
+	}
+
+	payload, err := ioutil.ReadAll(source)
+	if err != nil {
+		return cc_messages.DesireAppRequestFromCC{}, err
+	}
+
+	desiredApp := cc_messages.DesireAppRequestFromCC{}
+	err = json.Unmarshal(payload, &desiredApp)
+	return desiredApp, err
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,30 @@
+package main_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"testing"
+)
+
+var recipePath string
+
+func TestRecipe(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Recipe Suite")
+}
+
+var _ = SynchronizedBeforeSuite(func() []byte {
+	recipe, err := gexec.Build("github.com/cloudfoundry-incubator/nsync/cmd/nsync-recipe")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	return []byte(recipe)
+}, func(recipe []byte) {
+	recipePath = string(recipe)
+})
+
+var _ = SynchronizedAfterSuite(func() {
+}, func() {
+	gexec.CleanupBuildArtifacts()
+})
@@ -0,0 +1,180 @@
+package main_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Rendering a recipe", func() {
+	var (
+		payload string
+		args    []string
+		session *gexec.Session
+	)
+
+	BeforeEach(func() {
+		payload = `{
+			"process_guid": "the-guid",
+			"droplet_uri": "http://the-droplet.uri.com",
+			"start_command": "the-start-command",
+			"memory_mb": 128,
+			"disk_mb": 512,
+			"num_instances": 3,
+			"stack": "some-stack",
+			"log_guid": "the-log-guid",
+			"etag": "1.1"
+		}`
+
+		args = []string{
+			"-lifecycles", `{"some-stack": "some-lifecycle.tgz"}`,
+			"-dockerLifecyclePath", "the/docker/lifecycle/path.tgz",
+			"-fileServerURL", "http://file-server.com",
+		}
+	})
+
+	run := func(stdin string, extraArgs ...string) {
+		command := exec.Command(recipePath, append(args, extraArgs...)...)
+		command.Stdin = strings.NewReader(stdin)
+
+		var err error
+		session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	itRendersTheCreateRequest := func() {
+		It("prints the create request as json", func() {
+			Eventually(session).Should(gexec.Exit(0))
+
+			desiredLRP := receptor.DesiredLRPCreateRequest{}
+			err := json.Unmarshal(session.Out.Contents(), &desiredLRP)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(desiredLRP.ProcessGuid).Should(Equal("the-guid"))
+			Ω(desiredLRP.Instances).Should(Equal(3))
+			Ω(desiredLRP.Action.(*models.RunAction).Path).Should(Equal("/tmp/lifecycle/launcher"))
+		})
+	}
+
+	Context("when the desire message comes from stdin", func() {
+		JustBeforeEach(func() {
+			run(payload)
+		})
+
+		itRendersTheCreateRequest()
+	})
+
+	Context("when the desire message comes from a file", func() {
+		var path string
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "desire-app-request")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = file.WriteString(payload)
+			Ω(err).ShouldNot(HaveOccurred())
+			file.Close()
+
+			path = file.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		JustBeforeEach(func() {
+			run("", path)
+		})
+
+		itRendersTheCreateRequest()
+	})
+
+	Context("when the recipe cannot be built", func() {
+		BeforeEach(func() {
+			payload = `{"process_guid": "the-guid", "stack": "some-stack", "num_instances": 1}`
+		})
+
+		JustBeforeEach(func() {
+			run(payload)
+		})
+
+		It("exits non-zero with the build error", func() {
+			Eventually(session).Should(gexec.Exit(1))
+			Ω(session.Err).Should(gbytes.Say("missing both droplet_uri and docker_image"))
+			Ω(session.Out.Contents()).Should(BeEmpty())
+		})
+	})
+
+	Context("when the builder is configured like the daemons", func() {
+		var platformEnvFile string
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "platform-env")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = file.WriteString(`{"PLATFORM_VAR": "platform-value"}`)
+			Ω(err).ShouldNot(HaveOccurred())
+			file.Close()
+
+			platformEnvFile = file.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(platformEnvFile)
+		})
+
+		JustBeforeEach(func() {
+			run(payload,
+				"-platformEnvFile", platformEnvFile,
+				"-healthCheckTimeout", "45s",
+				"-privilegedMode", "lifecycle",
+			)
+		})
+
+		It("renders the recipe the daemons would submit", func() {
+			Eventually(session).Should(gexec.Exit(0))
+
+			desiredLRP := receptor.DesiredLRPCreateRequest{}
+			err := json.Unmarshal(session.Out.Contents(), &desiredLRP)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(desiredLRP.Action.(*models.RunAction).Env).Should(ContainElement(models.EnvironmentVariable{
+				Name:  "PLATFORM_VAR",
+				Value: "platform-value",
+			}))
+			Ω(desiredLRP.Monitor.(*models.TimeoutAction).Timeout).Should(Equal(45 * time.Second))
+		})
+	})
+
+	Context("when a recipe builder flag is invalid", func() {
+		JustBeforeEach(func() {
+			run(payload, "-privilegedMode", "sometimes")
+		})
+
+		It("exits non-zero naming the flag", func() {
+			Eventually(session).Should(gexec.Exit(1))
+			Ω(session.Err).Should(gbytes.Say("invalid -privilegedMode"))
+		})
+	})
+
+	Context("when the desire message is malformed", func() {
+		JustBeforeEach(func() {
+			run(`{"process_guid"`)
+		})
+
+		It("exits non-zero", func() {
+			Eventually(session).Should(gexec.Exit(1))
+			Ω(session.Err).Should(gbytes.Say("failed to read desire app request"))
+		})
+	})
+})
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/apcera/nats"
+
+	"github.com/cloudfoundry-incubator/nsync/deadletter"
+	"github.com/cloudfoundry-incubator/nsync/listen"
+)
+
+var deadLetterFile = flag.String(
+	"deadLetterFile",
+	"",
+	"path to the listener's dead letter file",
+)
+
+var natsAddresses = flag.String(
+	"natsAddresses",
+	"127.0.0.1:4222",
+	"comma-separated list of NATS addresses (ip:port)",
+)
+
+var natsUsername = flag.String(
+	"natsUsername",
+	"nats",
+	"Username to connect to nats",
+)
+
+var natsPassword = flag.String(
+	"natsPassword",
+	"nats",
+	"Password for nats user",
+)
+
+var processGuid = flag.String(
+	"processGuid",
+	"",
+	"only replay the messages of this process guid",
+)
+
+var list = flag.Bool(
+	"list",
+	false,
+	"print the dead letters instead of replaying them",
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -deadLetterFile path [flags]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Republishes the messages the nsync listener dead-lettered, so the listener handles them again,")
+		fmt.Fprintln(os.Stderr, "and removes them from the dead letter file.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *deadLetterFile == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	selected := func(entry deadletter.Entry) bool {
+		return *processGuid == "" || entry.ProcessGuid == *processGuid
+	}
+
+	if *list {
+		entries, err := deadletter.ReadEntries(*deadLetterFile)
+		if err != nil {
+			fail("failed to read dead letters: %s", err)
+		}
+
+		for _, entry := range entries {
+			if !selected(entry) {
+				continue
+			}
+
+			fmt.Printf("%s\t%s\t%s\tattempts=%d\t%s\n",
+				entry.Time.Format("2006-01-02T15:04:05Z07:00"),
+				entry.ProcessGuid,
+				entry.Operation,
+				entry.Attempts,
+				entry.Error,
+			)
+		}
+		return
+	}
+
+	conn, err := connect()
+	if err != nil {
+		fail("failed to connect to nats: %s", err)
+	}
+	defer conn.Close()
+
+	replayed, err := deadletter.Replay(*deadLetterFile, selected, func(entry deadletter.Entry) error {
+		topic, payload, err := message(entry)
+		if err != nil {
+			return fmt.Errorf("failed to replay %s of %s: %s", entry.Operation, entry.ProcessGuid, err)
+		}
+
+		err = conn.Publish(topic, payload)
+		if err == nil {
+			err = conn.Flush()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to replay %s of %s: %s", entry.Operation, entry.ProcessGuid, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		fail("failed to replay dead letters after replaying %d: %s", replayed, err)
+	}
+
+	fmt.Printf("replayed %d dead letters\n", replayed)
+}
+
+func connect() (*nats.Conn, error) {
+	options := nats.DefaultOptions
+	for _, address := range strings.Split(*natsAddresses, ",") {
+		options.Servers = append(options.Servers, fmt.Sprintf("nats://%s:%s@%s", *natsUsername, *natsPassword, strings.TrimSpace(address)))
+	}
+
+	return options.Connect()
+}
+
+// message rebuilds the NATS message the listener originally received.
+func message(entry deadletter.Entry) (string, []byte, error) {
+	switch {
+	case entry.DesireApp != nil:
+		payload, err := json.Marshal(entry.DesireApp)
+		return listen.DesireAppTopic, payload, err
+
+	case entry.KillIndex != nil:
+		payload, err := json.Marshal(entry.KillIndex)
+		return listen.KillIndexTopic, payload, err
+	}
+
+	return "", nil, fmt.Errorf("dead letter carries no message")
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
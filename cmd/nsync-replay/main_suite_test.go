@@ -0,0 +1,34 @@
+package main_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"testing"
+)
+
+var (
+	replayPath string
+	natsPort   int
+)
+
+func TestReplay(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Replay Suite")
+}
+
+var _ = SynchronizedBeforeSuite(func() []byte {
+	replay, err := gexec.Build("github.com/cloudfoundry-incubator/nsync/cmd/nsync-replay")
+	Ω(err).ShouldNot(HaveOccurred())
+
+	return []byte(replay)
+}, func(replay []byte) {
+	replayPath = string(replay)
+	natsPort = 4101 + GinkgoParallelNode()
+})
+
+var _ = SynchronizedAfterSuite(func() {
+}, func() {
+	gexec.CleanupBuildArtifacts()
+})
@@ -0,0 +1,155 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/apcera/nats"
+	"github.com/cloudfoundry-incubator/nsync/deadletter"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry/gunk/diegonats"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/ginkgomon"
+)
+
+var _ = Describe("Replaying dead letters", func() {
+	var (
+		tmpDir         string
+		deadLetterFile string
+
+		gnatsdProcess ifrit.Process
+		natsClient    diegonats.NATSClient
+
+		desires chan *nats.Msg
+		kills   chan *nats.Msg
+
+		session *gexec.Session
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "replay")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		deadLetterFile = filepath.Join(tmpDir, "dead-letters.log")
+
+		journal := deadletter.NewJournal(deadLetterFile)
+		Ω(journal.Append(deadletter.Entry{
+			Time:        time.Date(2015, time.May, 1, 12, 0, 0, 0, time.UTC),
+			ProcessGuid: "some-guid",
+			Operation:   "create",
+			Attempts:    5,
+			Error:       "connection refused",
+			DesireApp:   &cc_messages.DesireAppRequestFromCC{ProcessGuid: "some-guid", NumInstances: 3},
+		})).Should(Succeed())
+		Ω(journal.Append(deadletter.Entry{
+			Time:        time.Date(2015, time.May, 1, 12, 1, 0, 0, time.UTC),
+			ProcessGuid: "other-guid",
+			Operation:   "kill",
+			Attempts:    1,
+			Error:       "index not found",
+			KillIndex:   &cc_messages.KillIndexRequestFromCC{ProcessGuid: "other-guid", Index: 2},
+		})).Should(Succeed())
+
+		gnatsdProcess, natsClient = diegonats.StartGnatsd(natsPort)
+
+		desires = make(chan *nats.Msg, 10)
+		kills = make(chan *nats.Msg, 10)
+
+		_, err = natsClient.Subscribe("diego.desire.app", func(msg *nats.Msg) { desires <- msg })
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = natsClient.Subscribe("diego.stop.index", func(msg *nats.Msg) { kills <- msg })
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		ginkgomon.Kill(gnatsdProcess)
+		os.RemoveAll(tmpDir)
+	})
+
+	run := func(args ...string) {
+		command := exec.Command(replayPath, append([]string{
+			"-deadLetterFile", deadLetterFile,
+			"-natsAddresses", fmt.Sprintf("127.0.0.1:%d", natsPort),
+		}, args...)...)
+
+		var err error
+		session, err = gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	It("republishes every dead letter on its original topic", func() {
+		run()
+		Eventually(session).Should(gexec.Exit(0))
+		Ω(session.Out).Should(gbytes.Say("replayed 2 dead letters"))
+
+		var desire *nats.Msg
+		Eventually(desires).Should(Receive(&desire))
+		replayed := cc_messages.DesireAppRequestFromCC{}
+		Ω(json.Unmarshal(desire.Data, &replayed)).Should(Succeed())
+		Ω(replayed).Should(Equal(cc_messages.DesireAppRequestFromCC{ProcessGuid: "some-guid", NumInstances: 3}))
+
+		var kill *nats.Msg
+		Eventually(kills).Should(Receive(&kill))
+		Ω(kill.Data).Should(MatchJSON(`{"process_guid": "other-guid", "index": 2}`))
+	})
+
+	It("removes the replayed dead letters, so a second run replays nothing", func() {
+		run()
+		Eventually(session).Should(gexec.Exit(0))
+		Eventually(desires).Should(Receive())
+		Eventually(kills).Should(Receive())
+
+		run()
+		Eventually(session).Should(gexec.Exit(0))
+		Ω(session.Out).Should(gbytes.Say("replayed 0 dead letters"))
+
+		Consistently(desires).ShouldNot(Receive())
+		Consistently(kills).ShouldNot(Receive())
+	})
+
+	It("replays only the messages of the requested process guid", func() {
+		run("-processGuid", "other-guid")
+		Eventually(session).Should(gexec.Exit(0))
+		Ω(session.Out).Should(gbytes.Say("replayed 1 dead letters"))
+
+		Eventually(kills).Should(Receive())
+		Consistently(desires).ShouldNot(Receive())
+
+		entries, err := deadletter.ReadEntries(deadLetterFile)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(HaveLen(1))
+		Ω(entries[0].ProcessGuid).Should(Equal("some-guid"))
+	})
+
+	It("lists the dead letters without replaying them", func() {
+		run("-list")
+		Eventually(session).Should(gexec.Exit(0))
+		Ω(session.Out).Should(gbytes.Say("some-guid\tcreate\tattempts=5\tconnection refused"))
+		Ω(session.Out).Should(gbytes.Say("other-guid\tkill\tattempts=1\tindex not found"))
+
+		Consistently(desires).ShouldNot(Receive())
+		Consistently(kills).ShouldNot(Receive())
+	})
+
+	Context("when the dead letter file does not exist", func() {
+		BeforeEach(func() {
+			deadLetterFile = filepath.Join(tmpDir, "missing.log")
+		})
+
+		It("fails", func() {
+			run()
+			Eventually(session).Should(gexec.Exit(1))
+			Ω(session.Err).Should(gbytes.Say("failed to replay dead letters"))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package deadletter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDeadLetter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dead Letter Suite")
+}
@@ -0,0 +1,53 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/nsync/deadletter"
+)
+
+type FakeJournal struct {
+	AppendStub        func(entry deadletter.Entry) error
+	appendMutex       sync.RWMutex
+	appendArgsForCall []struct {
+		entry deadletter.Entry
+	}
+	appendReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeJournal) Append(entry deadletter.Entry) error {
+	fake.appendMutex.Lock()
+	fake.appendArgsForCall = append(fake.appendArgsForCall, struct {
+		entry deadletter.Entry
+	}{entry})
+	fake.appendMutex.Unlock()
+	if fake.AppendStub != nil {
+		return fake.AppendStub(entry)
+	} else {
+		return fake.appendReturns.result1
+	}
+}
+
+func (fake *FakeJournal) AppendCallCount() int {
+	fake.appendMutex.RLock()
+	defer fake.appendMutex.RUnlock()
+	return len(fake.appendArgsForCall)
+}
+
+func (fake *FakeJournal) AppendArgsForCall(i int) deadletter.Entry {
+	fake.appendMutex.RLock()
+	defer fake.appendMutex.RUnlock()
+	return fake.appendArgsForCall[i].entry
+}
+
+func (fake *FakeJournal) AppendReturns(result1 error) {
+	fake.AppendStub = nil
+	fake.appendReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ deadletter.Journal = new(FakeJournal)
@@ -0,0 +1,164 @@
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+)
+
+// An Entry records a listener message whose operation could not be applied.
+// Exactly one of DesireApp and KillIndex is set.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	ProcessGuid string    `json:"process_guid"`
+	Operation   string    `json:"operation"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error"`
+
+	DesireApp *cc_messages.DesireAppRequestFromCC `json:"desire_app,omitempty"`
+	KillIndex *cc_messages.KillIndexRequestFromCC `json:"kill_index,omitempty"`
+}
+
+//go:generate counterfeiter -o fakes/fake_journal.go . Journal
+
+// A Journal keeps dead letters for operators to inspect and replay.
+type Journal interface {
+	Append(entry Entry) error
+}
+
+type fileJournal struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewJournal appends entries to the file at path, one JSON object per line.
+func NewJournal(path string) Journal {
+	return &fileJournal{path: path}
+}
+
+func (j *fileJournal) Append(entry Entry) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	lock, err := lockJournal(j.path)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	return appendEntries(j.path, []Entry{entry})
+}
+
+// lockJournal takes the lock that a replay holds while it rewrites the
+// journal at path, which is shared with other processes. Closing the
+// returned file releases it.
+func lockJournal(path string) (*os.File, error) {
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// appendEntries adds entries to the end of the file at path in a single
+// write, creating the file if need be.
+func appendEntries(path string, entries []Entry) error {
+	encoded, err := encodeEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(encoded)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// writeEntries replaces the file at path with entries, through a temporary
+// file so that it never holds only some of them.
+func writeEntries(path string, entries []Entry) error {
+	encoded, err := encodeEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, encoded, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func encodeEntries(entries []Entry) ([]byte, error) {
+	encoded := []byte{}
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		encoded = append(encoded, line...)
+		encoded = append(encoded, '\n')
+	}
+
+	return encoded, nil
+}
+
+// ReadEntries reads every entry of a journal file, oldest first.
+func ReadEntries(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []Entry{}
+	reader := bufio.NewReader(file)
+
+	for line := 1; ; line++ {
+		contents, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(contents)) > 0 {
+			entry := Entry{}
+			jsonErr := json.Unmarshal(contents, &entry)
+			if jsonErr != nil {
+				return nil, fmt.Errorf("malformed dead letter on line %d: %s", line, jsonErr)
+			}
+
+			entries = append(entries, entry)
+		}
+
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
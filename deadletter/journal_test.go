@@ -0,0 +1,123 @@
+package deadletter_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/deadletter"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Journal", func() {
+	var (
+		tmpDir  string
+		path    string
+		journal deadletter.Journal
+
+		desireEntry deadletter.Entry
+		killEntry   deadletter.Entry
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "dead-letters")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		path = filepath.Join(tmpDir, "dead-letters.log")
+		journal = deadletter.NewJournal(path)
+
+		desireEntry = deadletter.Entry{
+			Time:        time.Date(2015, time.May, 1, 12, 0, 0, 0, time.UTC),
+			ProcessGuid: "some-guid",
+			Operation:   "create",
+			Attempts:    5,
+			Error:       "connection refused",
+			DesireApp: &cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:  "some-guid",
+				NumInstances: 3,
+			},
+		}
+
+		killEntry = deadletter.Entry{
+			Time:        time.Date(2015, time.May, 1, 12, 1, 0, 0, time.UTC),
+			ProcessGuid: "other-guid",
+			Operation:   "kill",
+			Attempts:    1,
+			Error:       "index not found",
+			KillIndex: &cc_messages.KillIndexRequestFromCC{
+				ProcessGuid: "other-guid",
+				Index:       2,
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("reads back the entries in the order they were appended", func() {
+		Ω(journal.Append(desireEntry)).Should(Succeed())
+		Ω(journal.Append(killEntry)).Should(Succeed())
+
+		entries, err := deadletter.ReadEntries(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(Equal([]deadletter.Entry{desireEntry, killEntry}))
+	})
+
+	It("keeps the entries of earlier journals on the same file", func() {
+		Ω(journal.Append(desireEntry)).Should(Succeed())
+		Ω(deadletter.NewJournal(path).Append(killEntry)).Should(Succeed())
+
+		entries, err := deadletter.ReadEntries(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(HaveLen(2))
+	})
+
+	It("is only readable by its owner", func() {
+		Ω(journal.Append(desireEntry)).Should(Succeed())
+
+		info, err := os.Stat(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+	})
+
+	Context("when the journal cannot be written", func() {
+		BeforeEach(func() {
+			journal = deadletter.NewJournal(filepath.Join(tmpDir, "missing", "dead-letters.log"))
+		})
+
+		It("errors", func() {
+			Ω(journal.Append(desireEntry)).ShouldNot(Succeed())
+		})
+	})
+
+	Describe("ReadEntries", func() {
+		It("errors when the file does not exist", func() {
+			_, err := deadletter.ReadEntries(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("errors on malformed entries", func() {
+			err := ioutil.WriteFile(path, []byte("{\"operation\":\"create\"}\n{\"operation\"\n"), 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = deadletter.ReadEntries(path)
+			Ω(err).Should(MatchError(ContainSubstring("line 2")))
+		})
+
+		It("reads a final entry without a trailing newline", func() {
+			err := ioutil.WriteFile(path, []byte(`{"operation":"delete","process_guid":"some-guid"}`), 0600)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			entries, err := deadletter.ReadEntries(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(HaveLen(1))
+			Ω(entries[0].Operation).Should(Equal("delete"))
+		})
+	})
+})
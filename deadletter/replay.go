@@ -0,0 +1,118 @@
+package deadletter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Replay hands each entry of the journal at path that matches selected to
+// replay, and removes the entries it replays from the journal. It stops
+// replaying at the first error, keeping that entry and the ones after it.
+//
+// The journal is moved aside while replaying, so that entries the listener
+// appends meanwhile land in a new journal. Each entry is dropped from the
+// moved journal as soon as it is replayed, and the kept ones are written
+// back ahead of the new entries, so the journal stays oldest first. A replay
+// that was interrupted is resumed by the next one, without replaying what it
+// already replayed, before the new journal is touched.
+func Replay(path string, selected func(Entry) bool, replay func(Entry) error) (int, error) {
+	replaying := path + ".replaying"
+
+	err := moveAside(path, replaying)
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := ReadEntries(replaying)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", replaying, err)
+	}
+
+	kept := []Entry{}
+	replayed := 0
+	var replayErr error
+
+	for i, entry := range entries {
+		if replayErr != nil || !selected(entry) {
+			kept = append(kept, entry)
+			continue
+		}
+
+		replayErr = replay(entry)
+		if replayErr != nil {
+			kept = append(kept, entry)
+			continue
+		}
+
+		replayed++
+
+		remaining := append(append([]Entry{}, kept...), entries[i+1:]...)
+		err = writeEntries(replaying, remaining)
+		if err != nil {
+			return replayed, err
+		}
+	}
+
+	err = putBack(path, replaying, kept)
+	if err != nil {
+		return replayed, err
+	}
+
+	return replayed, replayErr
+}
+
+// moveAside moves the journal at path to replaying, unless an interrupted
+// replay left entries there. When that replay had already put them back at
+// the head of the journal, the leftover is dropped and the journal is moved
+// aside as usual.
+func moveAside(path, replaying string) error {
+	leftover, err := ioutil.ReadFile(replaying)
+	if os.IsNotExist(err) {
+		return os.Rename(path, replaying)
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if len(leftover) == 0 || !bytes.HasPrefix(current, leftover) {
+		return nil
+	}
+
+	err = os.Remove(replaying)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(path, replaying)
+}
+
+// putBack writes the kept entries ahead of those appended to the journal
+// while replaying, then removes the file they were replayed from.
+func putBack(path, replaying string, kept []Entry) error {
+	lock, err := lockJournal(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	appended, err := ReadEntries(path)
+	if os.IsNotExist(err) {
+		appended = nil
+	} else if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	err = writeEntries(path, append(kept, appended...))
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(replaying)
+}
@@ -0,0 +1,228 @@
+package deadletter_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/nsync/deadletter"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Replay", func() {
+	var (
+		tmpDir  string
+		path    string
+		journal deadletter.Journal
+
+		desireEntry deadletter.Entry
+		killEntry   deadletter.Entry
+
+		selected func(deadletter.Entry) bool
+		replay   func(deadletter.Entry) error
+		replayed []deadletter.Entry
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "dead-letters")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		path = filepath.Join(tmpDir, "dead-letters.log")
+		journal = deadletter.NewJournal(path)
+
+		desireEntry = deadletter.Entry{
+			ProcessGuid: "some-guid",
+			Operation:   "create",
+			DesireApp:   &cc_messages.DesireAppRequestFromCC{ProcessGuid: "some-guid"},
+		}
+		killEntry = deadletter.Entry{
+			ProcessGuid: "other-guid",
+			Operation:   "kill",
+			KillIndex:   &cc_messages.KillIndexRequestFromCC{ProcessGuid: "other-guid", Index: 2},
+		}
+
+		Ω(journal.Append(desireEntry)).Should(Succeed())
+		Ω(journal.Append(killEntry)).Should(Succeed())
+
+		replayed = []deadletter.Entry{}
+		selected = func(deadletter.Entry) bool { return true }
+		replay = func(entry deadletter.Entry) error {
+			replayed = append(replayed, entry)
+			return nil
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	It("replays the entries and removes them from the journal", func() {
+		count, err := deadletter.Replay(path, selected, replay)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(count).Should(Equal(2))
+		Ω(replayed).Should(Equal([]deadletter.Entry{desireEntry, killEntry}))
+
+		entries, err := deadletter.ReadEntries(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(BeEmpty())
+	})
+
+	It("replays nothing the second time", func() {
+		_, err := deadletter.Replay(path, selected, replay)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		replayed = []deadletter.Entry{}
+
+		count, err := deadletter.Replay(path, selected, replay)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(count).Should(Equal(0))
+		Ω(replayed).Should(BeEmpty())
+	})
+
+	It("keeps the entries that are not selected", func() {
+		selected = func(entry deadletter.Entry) bool { return entry.ProcessGuid == "other-guid" }
+
+		count, err := deadletter.Replay(path, selected, replay)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(count).Should(Equal(1))
+
+		entries, err := deadletter.ReadEntries(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(Equal([]deadletter.Entry{desireEntry}))
+	})
+
+	It("keeps the entries appended while replaying", func() {
+		appended := deadletter.Entry{ProcessGuid: "new-guid", Operation: "delete"}
+		replay = func(deadletter.Entry) error {
+			return journal.Append(appended)
+		}
+
+		_, err := deadletter.Replay(path, selected, replay)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		entries, err := deadletter.ReadEntries(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(Equal([]deadletter.Entry{appended, appended}))
+	})
+
+	It("writes the entries it keeps ahead of those appended while replaying", func() {
+		appended := deadletter.Entry{ProcessGuid: "new-guid", Operation: "delete"}
+		selected = func(entry deadletter.Entry) bool { return entry.ProcessGuid == "other-guid" }
+		replay = func(deadletter.Entry) error {
+			return journal.Append(appended)
+		}
+
+		_, err := deadletter.Replay(path, selected, replay)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		entries, err := deadletter.ReadEntries(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(entries).Should(Equal([]deadletter.Entry{desireEntry, appended}))
+	})
+
+	It("drops each entry from the replayed journal as soon as it is replayed", func() {
+		replay = func(entry deadletter.Entry) error {
+			if entry.ProcessGuid == "other-guid" {
+				remaining, err := deadletter.ReadEntries(path + ".replaying")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(remaining).Should(Equal([]deadletter.Entry{killEntry}))
+			}
+
+			return nil
+		}
+
+		count, err := deadletter.Replay(path, selected, replay)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(count).Should(Equal(2))
+	})
+
+	Context("when replaying an entry fails", func() {
+		BeforeEach(func() {
+			replay = func(deadletter.Entry) error {
+				return errors.New("nats is down")
+			}
+		})
+
+		It("keeps that entry and the ones after it", func() {
+			count, err := deadletter.Replay(path, selected, replay)
+			Ω(err).Should(MatchError("nats is down"))
+			Ω(count).Should(Equal(0))
+
+			entries, err := deadletter.ReadEntries(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(Equal([]deadletter.Entry{desireEntry, killEntry}))
+		})
+	})
+
+	Context("when an earlier replay was interrupted", func() {
+		BeforeEach(func() {
+			Ω(os.Rename(path, path+".replaying")).Should(Succeed())
+			Ω(journal.Append(killEntry)).Should(Succeed())
+		})
+
+		It("resumes it before touching the journal", func() {
+			count, err := deadletter.Replay(path, selected, replay)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(count).Should(Equal(2))
+			Ω(replayed).Should(Equal([]deadletter.Entry{desireEntry, killEntry}))
+
+			entries, err := deadletter.ReadEntries(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(Equal([]deadletter.Entry{killEntry}))
+		})
+	})
+
+	Context("when an earlier replay was interrupted after replaying some entries", func() {
+		BeforeEach(func() {
+			Ω(os.Remove(path)).Should(Succeed())
+			Ω(deadletter.NewJournal(path + ".replaying").Append(killEntry)).Should(Succeed())
+		})
+
+		It("only replays what was left", func() {
+			count, err := deadletter.Replay(path, selected, replay)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(count).Should(Equal(1))
+			Ω(replayed).Should(Equal([]deadletter.Entry{killEntry}))
+		})
+	})
+
+	Context("when an earlier replay was interrupted after putting back the entries it kept", func() {
+		var appended deadletter.Entry
+
+		BeforeEach(func() {
+			appended = deadletter.Entry{ProcessGuid: "new-guid", Operation: "delete"}
+
+			Ω(os.Remove(path)).Should(Succeed())
+			Ω(deadletter.NewJournal(path + ".replaying").Append(desireEntry)).Should(Succeed())
+			Ω(journal.Append(desireEntry)).Should(Succeed())
+			Ω(journal.Append(appended)).Should(Succeed())
+		})
+
+		It("replays each entry once", func() {
+			count, err := deadletter.Replay(path, selected, replay)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(count).Should(Equal(2))
+			Ω(replayed).Should(Equal([]deadletter.Entry{desireEntry, appended}))
+
+			entries, err := deadletter.ReadEntries(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(entries).Should(BeEmpty())
+		})
+	})
+
+	Context("when the journal does not exist", func() {
+		BeforeEach(func() {
+			path = filepath.Join(tmpDir, "missing.log")
+		})
+
+		It("errors", func() {
+			_, err := deadletter.Replay(path, selected, replay)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
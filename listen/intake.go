@@ -0,0 +1,191 @@
+package listen
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/metric"
+	"github.com/pivotal-golang/lager"
+)
+
+type OverflowPolicy string
+
+const (
+	// BlockOverflowPolicy makes subscribers wait for room in the intake.
+	BlockOverflowPolicy OverflowPolicy = "block"
+	// DropOldestOverflowPolicy discards the longest-waiting message.
+	DropOldestOverflowPolicy OverflowPolicy = "drop-oldest"
+	// DropNewestOverflowPolicy discards the message that did not fit.
+	DropNewestOverflowPolicy OverflowPolicy = "drop-newest"
+
+	DefaultOverflowPolicy = BlockOverflowPolicy
+	DefaultIntakeSize     = 1024
+
+	stoppedReason = "the listener is stopping"
+
+	intakeDepth         = metric.Metric("ListenerIntakeQueueDepth")
+	intakeDroppedCount  = metric.Counter("ListenerIntakeDropped")
+	intakeQueueDuration = metric.Duration("ListenerIntakeQueueTime")
+)
+
+func ParseOverflowPolicy(policy string) (OverflowPolicy, error) {
+	switch OverflowPolicy(policy) {
+	case BlockOverflowPolicy, DropOldestOverflowPolicy, DropNewestOverflowPolicy:
+		return OverflowPolicy(policy), nil
+	}
+
+	return "", fmt.Errorf("unknown overflow policy %q; expected block, drop-oldest or drop-newest", policy)
+}
+
+// A messageIntake buffers messages between the NATS subscriptions and the
+// listener, so that a slow listener does not stall the NATS client.
+type messageIntake struct {
+	items  chan intakeItem
+	size   int
+	policy OverflowPolicy
+	logger lager.Logger
+
+	// discard is called with every message the intake drops or discards.
+	discard discardFunc
+
+	// held counts the messages taken from the intake but not yet dispatched.
+	held int64
+
+	lock     sync.Mutex
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// A discardFunc is told about a message the intake will never hand out, and
+// why.
+type discardFunc func(value interface{}, reason string)
+
+type intakeItem struct {
+	value      interface{}
+	enqueuedAt time.Time
+}
+
+func newMessageIntake(size int, policy OverflowPolicy, discard discardFunc, logger lager.Logger) *messageIntake {
+	if size <= 0 {
+		size = DefaultIntakeSize
+	}
+
+	if policy == "" {
+		policy = DefaultOverflowPolicy
+	}
+
+	if discard == nil {
+		discard = func(interface{}, string) {}
+	}
+
+	return &messageIntake{
+		items:   make(chan intakeItem, size),
+		size:    size,
+		policy:  policy,
+		logger:  logger.Session("intake"),
+		discard: discard,
+		stopped: make(chan struct{}),
+	}
+}
+
+// push adds a message, applying the overflow policy when the intake is full.
+// Once the intake is stopped, blocked and later pushes are discarded.
+func (i *messageIntake) push(value interface{}) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	item := intakeItem{value: value, enqueuedAt: time.Now()}
+
+	for {
+		select {
+		case <-i.stopped:
+			i.discard(value, stoppedReason)
+			return
+		default:
+		}
+
+		select {
+		case i.items <- item:
+			intakeDepth.Send(i.depth())
+			return
+		default:
+		}
+
+		switch i.policy {
+		case DropNewestOverflowPolicy:
+			i.dropped("newest", value)
+			return
+
+		case DropOldestOverflowPolicy:
+			select {
+			case oldest := <-i.items:
+				i.dropped("oldest", oldest.value)
+			default:
+			}
+
+		default:
+			select {
+			case i.items <- item:
+				intakeDepth.Send(i.depth())
+			case <-i.stopped:
+				i.discard(value, stoppedReason)
+			}
+			return
+		}
+	}
+}
+
+// stop releases pushers blocked on a full intake, and discards the messages
+// still in it.
+func (i *messageIntake) stop() {
+	i.stopOnce.Do(func() {
+		close(i.stopped)
+
+		i.lock.Lock()
+		defer i.lock.Unlock()
+
+		for {
+			select {
+			case item := <-i.items:
+				i.discard(item.value, stoppedReason)
+			default:
+				return
+			}
+		}
+	})
+}
+
+func (i *messageIntake) received(item intakeItem) interface{} {
+	intakeDepth.Send(i.depth())
+
+	return item.value
+}
+
+// hold records how many messages the listener has taken from the intake but
+// not yet dispatched, so that the depth covers them too.
+func (i *messageIntake) hold(count int) {
+	atomic.StoreInt64(&i.held, int64(count))
+	intakeDepth.Send(i.depth())
+}
+
+// dispatched records how long a message waited between being pushed and
+// being handled.
+func (i *messageIntake) dispatched(enqueuedAt time.Time) {
+	intakeQueueDuration.Send(time.Since(enqueuedAt))
+}
+
+func (i *messageIntake) depth() int {
+	return len(i.items) + int(atomic.LoadInt64(&i.held))
+}
+
+func (i *messageIntake) dropped(which string, value interface{}) {
+	i.logger.Info("dropped-message", lager.Data{
+		"policy":  i.policy,
+		"dropped": which,
+	})
+	intakeDroppedCount.Increment()
+
+	i.discard(value, fmt.Sprintf("dropped by the %s intake overflow policy", i.policy))
+}
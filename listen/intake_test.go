@@ -0,0 +1,21 @@
+package listen_test
+
+import (
+	. "github.com/cloudfoundry-incubator/nsync/listen"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseOverflowPolicy", func() {
+	It("accepts the known policies", func() {
+		Ω(ParseOverflowPolicy("block")).Should(Equal(BlockOverflowPolicy))
+		Ω(ParseOverflowPolicy("drop-oldest")).Should(Equal(DropOldestOverflowPolicy))
+		Ω(ParseOverflowPolicy("drop-newest")).Should(Equal(DropNewestOverflowPolicy))
+	})
+
+	It("rejects anything else", func() {
+		_, err := ParseOverflowPolicy("drop-random")
+		Ω(err).Should(HaveOccurred())
+	})
+})
@@ -6,12 +6,14 @@ import (
 	"sync"
 
 	"github.com/apcera/nats"
+	"github.com/cloudfoundry-incubator/nsync/deadletter"
 	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/nsync/recreator"
 	"github.com/cloudfoundry-incubator/receptor"
-	"github.com/cloudfoundry-incubator/route-emitter/cfroutes"
 	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
 	"github.com/cloudfoundry-incubator/runtime-schema/metric"
 	"github.com/cloudfoundry/gunk/diegonats"
+	"github.com/pivotal-golang/clock"
 	"github.com/pivotal-golang/lager"
 )
 
@@ -20,51 +22,85 @@ const (
 	DesireDockerAppTopic = "diego.docker.desire.app"
 	KillIndexTopic       = "diego.stop.index"
 
-	desiredLRPCounter = metric.Counter("LRPsDesired")
-)
-
-type desireAppChan chan cc_messages.DesireAppRequestFromCC
-
-func (desiredApps desireAppChan) sendDesireAppRequest(message *nats.Msg, logger lager.Logger) {
-	desireAppMessage := cc_messages.DesireAppRequestFromCC{}
-	err := json.Unmarshal(message.Data, &desireAppMessage)
-	if err != nil {
-		logger.Error("parse-nats-message-failed", err)
-		return
-	}
+	DefaultMaxInFlight = 20
 
-	desiredApps <- desireAppMessage
-}
+	desiredLRPCounter        = metric.Counter("LRPsDesired")
+	invalidDesiredLRPCounter = metric.Counter("LRPsDesiredInvalid")
+	supersededDesireCounter  = metric.Counter("LRPDesiresSuperseded")
+	outOfDateDesireCounter   = metric.Counter("LRPDesiresOutOfDate")
+)
 
 type RecipeBuilder interface {
 	Build(*cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPCreateRequest, error)
+	BuildUpdate(*cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPUpdateRequest, error)
 }
 
 type Listen struct {
 	RecipeBuilder  RecipeBuilder
 	NATSClient     diegonats.NATSClient
 	ReceptorClient receptor.Client
+	Recreator      recreator.Recreator
 	Logger         lager.Logger
+
+	// MaxInFlight limits how many process guids have a message handled at
+	// once; it defaults to DefaultMaxInFlight.
+	MaxInFlight int
+
+	// IntakeSize bounds the messages received but not yet queued by process
+	// guid, and the messages queued behind another for their guid. Once that
+	// queue is full the listener stops taking messages from the intake, and
+	// OverflowPolicy decides what happens when the intake fills too.
+	IntakeSize     int
+	OverflowPolicy OverflowPolicy
+
+	// Retry retries receptor operations that fail with transient errors.
+	Retry RetryPolicy
+	// DeadLetters records the messages whose operations finally failed;
+	// they are only logged when it is nil.
+	DeadLetters deadletter.Journal
+	// Clock defaults to the real clock.
+	Clock clock.Clock
+
+	stopping chan struct{}
 }
 
+// Run handles the messages of each process guid one at a time, in the order
+// they arrive, so that a quick scale up and down cannot land out of order.
+// A desire still waiting behind another message for its guid is replaced by
+// any newer desire.
 func (listen Listen) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	maxInFlight := listen.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlight
+	}
+
+	if listen.Clock == nil {
+		listen.Clock = clock.NewClock()
+	}
+	listen.stopping = make(chan struct{})
+
 	wg := new(sync.WaitGroup)
-	desiredApps := make(desireAppChan)
-	killIndexChan := make(chan cc_messages.KillIndexRequestFromCC)
+	queue := newProcessQueue(maxInFlight)
+	done := make(chan string, maxInFlight)
 
-	desiredAppsSub, err := listen.listenForDesiredApps(desiredApps)
+	intake := newMessageIntake(listen.IntakeSize, listen.OverflowPolicy, func(value interface{}, reason string) {
+		listen.discard(value.(message), reason)
+	}, listen.Logger)
+	defer intake.stop()
+
+	desiredAppsSub, err := listen.listenForDesiredApps(intake)
 	if err != nil {
 		return err
 	}
 	defer desiredAppsSub.Unsubscribe()
 
-	desiredDockerSub, err := listen.listenForDesiredDockerApps(desiredApps)
+	desiredDockerSub, err := listen.listenForDesiredDockerApps(intake)
 	if err != nil {
 		return err
 	}
 	defer desiredDockerSub.Unsubscribe()
 
-	killIndexSub, err := listen.listenForKillIndex(killIndexChan)
+	killIndexSub, err := listen.listenForKillIndex(intake)
 	if err != nil {
 		return err
 	}
@@ -73,30 +109,87 @@ func (listen Listen) Run(signals <-chan os.Signal, ready chan<- struct{}) error
 	close(ready)
 
 	for {
+		items := intake.items
+		if queue.len() >= intake.size {
+			items = nil
+		}
+
 		select {
-		case msg := <-desiredApps:
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				listen.processDesireAppRequest(msg)
-			}()
+		case item := <-items:
+			msg := intake.received(item).(message)
+			msg.enqueuedAt = item.enqueuedAt
+			listen.enqueue(queue, msg)
 
-		case msg := <-killIndexChan:
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				listen.killIndex(msg)
-			}()
+		case processGuid := <-done:
+			queue.done(processGuid)
 
 		case <-signals:
+			intake.stop()
+
+			pending := queue.drain()
+			if len(pending) > 0 {
+				listen.Logger.Info("dropping-pending-messages", lager.Data{"pending": len(pending)})
+			}
+
+			for _, msg := range pending {
+				listen.discard(msg, stoppedReason)
+			}
+
+			close(listen.stopping)
+
 			wg.Wait()
 			return nil
 		}
+
+		for {
+			msg, ok := queue.next()
+			if !ok {
+				break
+			}
+
+			intake.dispatched(msg.enqueuedAt)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				listen.handle(msg)
+				done <- msg.processGuid
+			}()
+		}
+
+		intake.hold(queue.len())
+	}
+}
+
+func (listen Listen) enqueue(queue *processQueue, msg message) {
+	if superseded, ok := queue.push(msg); ok {
+		listen.Logger.Info("superseded-desire-app", lager.Data{"process-guid": msg.processGuid})
+		supersededDesireCounter.Increment()
+		listen.discard(superseded, "superseded by a newer desire")
+	}
+}
+
+// discard replies to a desire that will never be handled.
+func (listen Listen) discard(msg message, reason string) {
+	if msg.desire != nil {
+		listen.reply(msg.reply, dropped(msg.processGuid, reason))
 	}
 }
 
+func (listen Listen) handle(msg message) {
+	if msg.desire != nil {
+		result := listen.processDesireAppRequest(*msg.desire)
+		listen.reply(msg.reply, result)
+		return
+	}
+
+	listen.killIndex(*msg.kill)
+}
+
 func (listen Listen) killIndex(msg cc_messages.KillIndexRequestFromCC) {
-	err := listen.ReceptorClient.KillActualLRPByProcessGuidAndIndex(msg.ProcessGuid, msg.Index)
+	err := listen.retry(listen.Logger, "kill", message{processGuid: msg.ProcessGuid, kill: &msg}, func() error {
+		return listen.ReceptorClient.KillActualLRPByProcessGuidAndIndex(msg.ProcessGuid, msg.Index)
+	})
 	if err != nil {
 		listen.Logger.Error("request-stop-index-failed", err)
 		return
@@ -107,113 +200,225 @@ func (listen Listen) killIndex(msg cc_messages.KillIndexRequestFromCC) {
 	})
 }
 
-func (listen Listen) listenForKillIndex(killIndexChan chan cc_messages.KillIndexRequestFromCC) (*nats.Subscription, error) {
-	return listen.NATSClient.Subscribe(KillIndexTopic, func(message *nats.Msg) {
+func (listen Listen) listenForKillIndex(intake *messageIntake) (*nats.Subscription, error) {
+	return listen.NATSClient.Subscribe(KillIndexTopic, func(msg *nats.Msg) {
 		killIndexReq := cc_messages.KillIndexRequestFromCC{}
-		err := json.Unmarshal(message.Data, &killIndexReq)
+		err := json.Unmarshal(msg.Data, &killIndexReq)
 		if err != nil {
 			listen.Logger.Error("unmarshal-kill-index-request-failed", err)
 			return
 		}
-		killIndexChan <- killIndexReq
+
+		intake.push(message{processGuid: killIndexReq.ProcessGuid, kill: &killIndexReq})
 	})
 }
 
-func (listen Listen) listenForDesiredApps(desiredApps desireAppChan) (*nats.Subscription, error) {
-	return listen.NATSClient.Subscribe(DesireAppTopic, func(message *nats.Msg) {
-		desiredApps.sendDesireAppRequest(message, listen.Logger)
+func (listen Listen) listenForDesiredApps(intake *messageIntake) (*nats.Subscription, error) {
+	return listen.NATSClient.Subscribe(DesireAppTopic, func(msg *nats.Msg) {
+		listen.pushDesireAppRequest(intake, msg)
 	})
 }
 
-func (listen Listen) listenForDesiredDockerApps(desiredApps desireAppChan) (*nats.Subscription, error) {
-	return listen.NATSClient.Subscribe(DesireDockerAppTopic, func(message *nats.Msg) {
-		desiredApps.sendDesireAppRequest(message, listen.Logger)
+func (listen Listen) listenForDesiredDockerApps(intake *messageIntake) (*nats.Subscription, error) {
+	return listen.NATSClient.Subscribe(DesireDockerAppTopic, func(msg *nats.Msg) {
+		listen.pushDesireAppRequest(intake, msg)
+	})
+}
+
+func (listen Listen) pushDesireAppRequest(intake *messageIntake, msg *nats.Msg) {
+	desireAppMessage := cc_messages.DesireAppRequestFromCC{}
+	err := json.Unmarshal(msg.Data, &desireAppMessage)
+	if err != nil {
+		listen.Logger.Error("parse-nats-message-failed", err)
+		return
+	}
+
+	intake.push(message{
+		processGuid: desireAppMessage.ProcessGuid,
+		desire:      &desireAppMessage,
+		reply:       msg.Reply,
 	})
 }
 
-func (listen Listen) processDesireAppRequest(desireAppMessage cc_messages.DesireAppRequestFromCC) {
+func (listen Listen) processDesireAppRequest(desireAppMessage cc_messages.DesireAppRequestFromCC) DesireAppResult {
 	requestLogger := listen.Logger.Session("desire-lrp", lager.Data{
 		"desired-app-message": desireAppMessage,
 	})
 
-	if desireAppMessage.NumInstances == 0 {
-		listen.deleteDesiredApp(requestLogger, desireAppMessage.ProcessGuid)
-		return
+	existingLRP, desiredAppExists, err := listen.getDesiredLRP(requestLogger, desireAppMessage)
+	if err != nil {
+		return failed(desireAppMessage.ProcessGuid, ReceptorErrorStatus, err)
 	}
 
-	desiredAppExists, err := listen.desiredAppExists(requestLogger, desireAppMessage.ProcessGuid)
-	if err != nil {
-		return
+	if desiredAppExists && listen.isOutOfDate(requestLogger, existingLRP, desireAppMessage) {
+		return dropped(desireAppMessage.ProcessGuid, "older than the existing desired LRP")
+	}
+
+	if desireAppMessage.NumInstances == 0 {
+		return listen.deleteDesiredApp(requestLogger, desireAppMessage)
 	}
 
 	desiredLRPCounter.Increment()
 
 	if desiredAppExists {
-		listen.updateDesiredApp(requestLogger, desireAppMessage)
-	} else {
-		listen.createDesiredApp(requestLogger, desireAppMessage)
+		return listen.updateDesiredApp(requestLogger, existingLRP, desireAppMessage)
 	}
+
+	return listen.createDesiredApp(requestLogger, desireAppMessage)
 }
 
-func (listen Listen) desiredAppExists(logger lager.Logger, processGuid string) (bool, error) {
-	_, err := listen.ReceptorClient.GetDesiredLRP(processGuid)
-	if err == nil {
-		return true, nil
+// isOutOfDate drops a message describing an older state of the app than the
+// existing LRP, such as one delayed in NATS behind a newer one.
+func (listen Listen) isOutOfDate(logger lager.Logger, existingLRP receptor.DesiredLRPResponse, desireAppMessage cc_messages.DesireAppRequestFromCC) bool {
+	existing := recipebuilder.ParseAnnotation(existingLRP.Annotation)
+	incoming := recipebuilder.NewAnnotation(desireAppMessage.ETag)
+
+	if !incoming.OlderThan(existing) {
+		return false
 	}
 
-	if rerr, ok := err.(receptor.Error); ok {
-		if rerr.Type == receptor.DesiredLRPNotFound {
-			return false, nil
+	logger.Info("dropping-out-of-date-desire", lager.Data{
+		"existing-etag": existing.ETag,
+		"incoming-etag": incoming.ETag,
+	})
+	outOfDateDesireCounter.Increment()
+
+	return true
+}
+
+// getDesiredLRP retries transient errors like every other receptor operation,
+// so that a blip cannot drop a desire, in particular one stopping the app.
+func (listen Listen) getDesiredLRP(logger lager.Logger, desireAppMessage cc_messages.DesireAppRequestFromCC) (receptor.DesiredLRPResponse, bool, error) {
+	var existingLRP receptor.DesiredLRPResponse
+	found := true
+
+	err := listen.retry(logger, "get", desireMessage(desireAppMessage), func() error {
+		var err error
+		existingLRP, err = listen.ReceptorClient.GetDesiredLRP(desireAppMessage.ProcessGuid)
+		if rerr, ok := err.(receptor.Error); ok && rerr.Type == receptor.DesiredLRPNotFound {
+			found = false
+			return nil
 		}
+
+		return err
+	})
+	if err != nil {
+		logger.Error("unexpected-error-from-get-desired-lrp", err)
+		return receptor.DesiredLRPResponse{}, false, err
 	}
 
-	logger.Error("unexpected-error-from-get-desired-lrp", err)
-	return false, err
+	return existingLRP, found, nil
 }
 
-func (listen Listen) createDesiredApp(logger lager.Logger, desireAppMessage cc_messages.DesireAppRequestFromCC) {
+func (listen Listen) createDesiredApp(logger lager.Logger, desireAppMessage cc_messages.DesireAppRequestFromCC) DesireAppResult {
 	desiredLRP, err := listen.RecipeBuilder.Build(&desireAppMessage)
+	if validationErr, ok := err.(recipebuilder.ValidationError); ok {
+		logger.Error("invalid-desired-lrp", err, lager.Data{"validation-errors": validationErr.Messages()})
+		invalidDesiredLRPCounter.Increment()
+		return failed(desireAppMessage.ProcessGuid, ValidationErrorStatus, err)
+	}
+
 	if err != nil {
 		logger.Error("failed-to-build-recipe", err)
-		return
+		return failed(desireAppMessage.ProcessGuid, BuildErrorStatus, err)
 	}
 
-	err = listen.ReceptorClient.CreateDesiredLRP(*desiredLRP)
+	err = listen.retry(logger, "create", desireMessage(desireAppMessage), func() error {
+		return listen.ReceptorClient.CreateDesiredLRP(*desiredLRP)
+	})
 	if err != nil {
 		logger.Error("failed-to-create", err)
+		return failed(desireAppMessage.ProcessGuid, ReceptorErrorStatus, err)
 	}
+
+	return succeeded(desireAppMessage.ProcessGuid)
 }
 
-func (listen Listen) updateDesiredApp(logger lager.Logger, desireAppMessage cc_messages.DesireAppRequestFromCC) {
+func (listen Listen) updateDesiredApp(logger lager.Logger, existingLRP receptor.DesiredLRPResponse, desireAppMessage cc_messages.DesireAppRequestFromCC) DesireAppResult {
+	if result, recreated := listen.recreateIfNotUpdatable(logger, existingLRP, desireAppMessage); recreated {
+		return result
+	}
 
-	desiredAppRoutes := cfroutes.CFRoutes{
-		{Hostnames: desireAppMessage.Routes, Port: recipebuilder.DefaultPort},
-	}.RoutingInfo()
+	updateRequest, err := listen.RecipeBuilder.BuildUpdate(&desireAppMessage)
+	if validationErr, ok := err.(recipebuilder.ValidationError); ok {
+		logger.Error("invalid-desired-lrp-update", err, lager.Data{"validation-errors": validationErr.Messages()})
+		invalidDesiredLRPCounter.Increment()
+		return failed(desireAppMessage.ProcessGuid, ValidationErrorStatus, err)
+	}
 
-	updateRequest := receptor.DesiredLRPUpdateRequest{
-		Annotation: &desireAppMessage.ETag,
-		Instances:  &desireAppMessage.NumInstances,
-		Routes:     desiredAppRoutes,
+	if err != nil {
+		logger.Error("failed-to-build-update", err)
+		return failed(desireAppMessage.ProcessGuid, BuildErrorStatus, err)
 	}
 
-	err := listen.ReceptorClient.UpdateDesiredLRP(desireAppMessage.ProcessGuid, updateRequest)
+	err = listen.retry(logger, "update", desireMessage(desireAppMessage), func() error {
+		return listen.ReceptorClient.UpdateDesiredLRP(desireAppMessage.ProcessGuid, *updateRequest)
+	})
 	if err != nil {
 		logger.Error("failed-to-update-lrp", err)
+		return failed(desireAppMessage.ProcessGuid, ReceptorErrorStatus, err)
 	}
+
+	return succeeded(desireAppMessage.ProcessGuid)
 }
 
-func (listen Listen) deleteDesiredApp(logger lager.Logger, processGuid string) {
-	err := listen.ReceptorClient.DeleteDesiredLRP(processGuid)
-	if err == nil {
-		return
+// recreateIfNotUpdatable replaces the existing LRP when it was built by an
+// older recipe builder or when the app changed in ways an update cannot apply.
+func (listen Listen) recreateIfNotUpdatable(logger lager.Logger, existingLRP receptor.DesiredLRPResponse, desireAppMessage cc_messages.DesireAppRequestFromCC) (DesireAppResult, bool) {
+	existing := recipebuilder.ParseAnnotation(existingLRP.Annotation)
+
+	desiredLRP, err := listen.RecipeBuilder.Build(&desireAppMessage)
+	if err != nil {
+		logger.Error("failed-to-build-recipe-for-comparison", err)
+		return DesireAppResult{}, false
 	}
 
-	if rerr, ok := err.(receptor.Error); ok {
-		if rerr.Type == receptor.DesiredLRPNotFound {
-			logger.Info("lrp-already-deleted")
-			return
+	// LRPs from before recipes were versioned are only recreated when they
+	// changed; otherwise the update stamps the current recipe version on them.
+	outdated := !existing.IsLegacy() && !existing.IsCurrentRecipe()
+	changes := recipebuilder.NonUpdatableChanges(existingLRP, desiredLRP)
+	if !outdated && len(changes) == 0 {
+		return DesireAppResult{}, false
+	}
+
+	logger.Info("recreating-lrp", lager.Data{
+		"outdated-recipe": outdated,
+		"changed-fields":  changes,
+	})
+
+	err = listen.Recreator.Recreate(logger, desiredLRP)
+	if err != nil {
+		logger.Error("failed-to-recreate", err)
+		return failed(desireAppMessage.ProcessGuid, ReceptorErrorStatus, err), true
+	}
+
+	return succeeded(desireAppMessage.ProcessGuid), true
+}
+
+func (listen Listen) deleteDesiredApp(logger lager.Logger, desireAppMessage cc_messages.DesireAppRequestFromCC) DesireAppResult {
+	alreadyDeleted := false
+
+	err := listen.retry(logger, "delete", desireMessage(desireAppMessage), func() error {
+		err := listen.ReceptorClient.DeleteDesiredLRP(desireAppMessage.ProcessGuid)
+		if rerr, ok := err.(receptor.Error); ok && rerr.Type == receptor.DesiredLRPNotFound {
+			alreadyDeleted = true
+			return nil
 		}
+
+		return err
+	})
+	if err != nil {
+		logger.Error("failed-to-remove", err)
+		return failed(desireAppMessage.ProcessGuid, ReceptorErrorStatus, err)
 	}
 
-	logger.Error("failed-to-remove", err)
+	if alreadyDeleted {
+		logger.Info("lrp-already-deleted")
+	}
+
+	return succeeded(desireAppMessage.ProcessGuid)
+}
+
+func desireMessage(desireAppMessage cc_messages.DesireAppRequestFromCC) message {
+	return message{processGuid: desireAppMessage.ProcessGuid, desire: &desireAppMessage}
 }
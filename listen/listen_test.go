@@ -4,9 +4,14 @@ import (
 	"encoding/json"
 	"errors"
 	"syscall"
+	"time"
 
+	"github.com/apcera/nats"
+	fake_deadletter "github.com/cloudfoundry-incubator/nsync/deadletter/fakes"
 	. "github.com/cloudfoundry-incubator/nsync/listen"
 	"github.com/cloudfoundry-incubator/nsync/listen/fakes"
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	fake_recreator "github.com/cloudfoundry-incubator/nsync/recreator/fakes"
 	"github.com/cloudfoundry-incubator/receptor"
 	"github.com/cloudfoundry-incubator/receptor/fake_receptor"
 	"github.com/cloudfoundry-incubator/route-emitter/cfroutes"
@@ -15,6 +20,7 @@ import (
 	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
 	"github.com/cloudfoundry/dropsonde/metrics"
 	"github.com/cloudfoundry/gunk/diegonats"
+	"github.com/pivotal-golang/clock/fakeclock"
 	"github.com/pivotal-golang/lager/lagertest"
 	"github.com/tedsuo/ifrit"
 
@@ -36,7 +42,9 @@ var _ = Describe("Listen", func() {
 		desireAppRequest   cc_messages.DesireAppRequestFromCC
 		logger             *lagertest.TestLogger
 		fakeReceptorClient *fake_receptor.FakeClient
+		recreator          *fake_recreator.FakeRecreator
 
+		runner  Listen
 		process ifrit.Process
 
 		metricSender *fake.FakeMetricSender
@@ -49,10 +57,12 @@ var _ = Describe("Listen", func() {
 
 		builder = new(fakes.FakeRecipeBuilder)
 		fakeReceptorClient = new(fake_receptor.FakeClient)
+		recreator = new(fake_recreator.FakeRecreator)
 
-		runner := Listen{
+		runner = Listen{
 			NATSClient:     fakenats,
 			ReceptorClient: fakeReceptorClient,
+			Recreator:      recreator,
 			Logger:         logger,
 			RecipeBuilder:  builder,
 		}
@@ -77,7 +87,9 @@ var _ = Describe("Listen", func() {
 
 		metricSender = fake.NewFakeMetricSender()
 		metrics.Initialize(metricSender)
+	})
 
+	JustBeforeEach(func() {
 		process = ifrit.Envoke(runner)
 	})
 
@@ -169,6 +181,31 @@ var _ = Describe("Listen", func() {
 				})
 			})
 
+			Context("when the built recipe is invalid", func() {
+				BeforeEach(func() {
+					builder.BuildReturns(nil, recipebuilder.ValidationError{
+						errors.New("bad-guid"),
+						errors.New("bad-route"),
+					})
+				})
+
+				It("logs every validation error", func() {
+					Eventually(logger.TestSink.Buffer).Should(gbytes.Say("invalid-desired-lrp"))
+					Ω(logger.TestSink.Buffer).Should(gbytes.Say("bad-guid"))
+					Ω(logger.TestSink.Buffer).Should(gbytes.Say("bad-route"))
+				})
+
+				It("counts the invalid LRP", func() {
+					Eventually(func() uint64 {
+						return metricSender.GetCounter("LRPsDesiredInvalid")
+					}).Should(Equal(uint64(1)))
+				})
+
+				It("does not desire the LRP", func() {
+					Consistently(fakeReceptorClient.CreateDesiredLRPCallCount).Should(Equal(0))
+				})
+			})
+
 			Context("when building the recipe fails to build", func() {
 				BeforeEach(func() {
 					builder.BuildReturns(nil, errors.New("oh no!"))
@@ -189,7 +226,27 @@ var _ = Describe("Listen", func() {
 			BeforeEach(func() {
 				fakeReceptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{
 					ProcessGuid: "some-guid",
+					MemoryMB:    128,
+					Annotation:  recipebuilder.NewAnnotation("old-etag").String(),
 				}, nil)
+
+				builder.BuildStub = func(desireAppRequest *cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPCreateRequest, error) {
+					return &receptor.DesiredLRPCreateRequest{
+						ProcessGuid: desireAppRequest.ProcessGuid,
+						MemoryMB:    desireAppRequest.MemoryMB,
+						Annotation:  recipebuilder.NewAnnotation(desireAppRequest.ETag).String(),
+					}, nil
+				}
+
+				builder.BuildUpdateStub = func(desireAppRequest *cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPUpdateRequest, error) {
+					return &receptor.DesiredLRPUpdateRequest{
+						Annotation: &desireAppRequest.ETag,
+						Instances:  &desireAppRequest.NumInstances,
+						Routes: cfroutes.CFRoutes{
+							{Hostnames: desireAppRequest.Routes, Port: 8080},
+						}.RoutingInfo(),
+					}, nil
+				}
 			})
 
 			It("checks to see if LRP already exists", func() {
@@ -206,6 +263,181 @@ var _ = Describe("Listen", func() {
 				Ω(updateRequest.Routes).Should(Equal(cfroutes.CFRoutes{
 					{Hostnames: []string{"route1", "route2"}, Port: 8080},
 				}.RoutingInfo()))
+
+				Ω(builder.BuildUpdateArgsForCall(0)).Should(Equal(&desireAppRequest))
+			})
+
+			It("does not recreate the LRP", func() {
+				Eventually(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(1))
+				Ω(recreator.RecreateCallCount()).Should(Equal(0))
+			})
+
+			Context("when the message is older than the existing LRP", func() {
+				BeforeEach(func() {
+					fakeReceptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{
+						ProcessGuid: "some-guid",
+						MemoryMB:    128,
+						Annotation:  recipebuilder.NewAnnotation("1429893726.5").String(),
+					}, nil)
+
+					desireAppRequest.ETag = "1429893700.25"
+				})
+
+				It("drops the message", func() {
+					Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+					Consistently(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+					Ω(recreator.RecreateCallCount()).Should(Equal(0))
+				})
+
+				It("logs and counts the drop", func() {
+					Eventually(logger).Should(gbytes.Say("dropping-out-of-date-desire"))
+					Ω(metricSender.GetCounter("LRPDesiresOutOfDate")).Should(Equal(uint64(1)))
+				})
+
+				Context("and it would stop the app", func() {
+					BeforeEach(func() {
+						desireAppRequest.NumInstances = 0
+					})
+
+					It("does not delete the LRP", func() {
+						Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+						Consistently(fakeReceptorClient.DeleteDesiredLRPCallCount).Should(Equal(0))
+					})
+				})
+			})
+
+			Context("when the message is newer than the existing LRP", func() {
+				BeforeEach(func() {
+					fakeReceptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{
+						ProcessGuid: "some-guid",
+						MemoryMB:    128,
+						Annotation:  recipebuilder.NewAnnotation("1429893700.25").String(),
+					}, nil)
+
+					desireAppRequest.ETag = "1429893726.5"
+				})
+
+				It("applies the message", func() {
+					Eventually(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(1))
+				})
+			})
+
+			Context("when the app changed in ways an update cannot apply", func() {
+				BeforeEach(func() {
+					desireAppRequest.MemoryMB = 256
+				})
+
+				It("recreates the LRP instead of updating it", func() {
+					Eventually(recreator.RecreateCallCount).Should(Equal(1))
+
+					_, desiredLRP := recreator.RecreateArgsForCall(0)
+					Ω(desiredLRP.ProcessGuid).Should(Equal("some-guid"))
+					Ω(desiredLRP.MemoryMB).Should(Equal(256))
+
+					Consistently(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+				})
+
+				It("logs the changed fields", func() {
+					Eventually(logger.TestSink.Buffer).Should(gbytes.Say("recreating-lrp"))
+					Ω(logger.TestSink.Buffer).Should(gbytes.Say("memory_mb"))
+				})
+
+				Context("when recreating fails", func() {
+					BeforeEach(func() {
+						recreator.RecreateReturns(errors.New("oh no!"))
+					})
+
+					It("logs an error", func() {
+						Eventually(logger.TestSink.Buffer).Should(gbytes.Say("failed-to-recreate"))
+					})
+				})
+			})
+
+			Context("when the LRP was built by an older recipe builder", func() {
+				BeforeEach(func() {
+					fakeReceptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{
+						ProcessGuid: "some-guid",
+						MemoryMB:    128,
+						Annotation:  `{"etag":"old-etag","recipe_version":"0"}`,
+					}, nil)
+				})
+
+				It("recreates the LRP", func() {
+					Eventually(recreator.RecreateCallCount).Should(Equal(1))
+					Consistently(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+				})
+			})
+
+			Context("when the LRP is from before recipes were versioned", func() {
+				BeforeEach(func() {
+					fakeReceptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{
+						ProcessGuid: "some-guid",
+						MemoryMB:    128,
+						Annotation:  "old-etag",
+					}, nil)
+				})
+
+				It("updates the LRP in place instead of recreating it", func() {
+					Eventually(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(1))
+					Ω(recreator.RecreateCallCount()).Should(Equal(0))
+				})
+
+				Context("and its memory changed", func() {
+					BeforeEach(func() {
+						desireAppRequest.MemoryMB = 256
+					})
+
+					It("recreates the LRP instead of updating it", func() {
+						Eventually(recreator.RecreateCallCount).Should(Equal(1))
+
+						_, desiredLRP := recreator.RecreateArgsForCall(0)
+						Ω(desiredLRP.MemoryMB).Should(Equal(256))
+
+						Consistently(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+					})
+				})
+			})
+
+			Context("when building the recipe for comparison fails", func() {
+				BeforeEach(func() {
+					builder.BuildReturns(nil, errors.New("oh no!"))
+				})
+
+				It("updates the LRP in place", func() {
+					Eventually(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(1))
+					Ω(recreator.RecreateCallCount()).Should(Equal(0))
+				})
+			})
+
+			Context("when building the update fails", func() {
+				BeforeEach(func() {
+					builder.BuildUpdateReturns(nil, errors.New("oh no!"))
+				})
+
+				It("logs an error", func() {
+					Eventually(logger.TestSink.Buffer).Should(gbytes.Say("failed-to-build-update"))
+					Eventually(logger.TestSink.Buffer).Should(gbytes.Say("oh no!"))
+				})
+
+				It("does not update the LRP", func() {
+					Consistently(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+				})
+			})
+
+			Context("when the update is invalid", func() {
+				BeforeEach(func() {
+					builder.BuildUpdateReturns(nil, recipebuilder.ValidationError{errors.New("num_instances 23 exceeds the limit of 10")})
+				})
+
+				It("does not update the LRP", func() {
+					Consistently(fakeReceptorClient.UpdateDesiredLRPCallCount).Should(Equal(0))
+				})
+
+				It("counts the invalid update", func() {
+					Eventually(func() uint64 {
+						return metricSender.GetCounter("LRPsDesiredInvalid")
+					}).Should(Equal(uint64(1)))
+				})
 			})
 		})
 	})
@@ -249,4 +481,605 @@ var _ = Describe("Listen", func() {
 			Ω(stopIndex).Should(Equal(killIndexRequest.Index))
 		})
 	})
+
+	Describe("ordering messages by process guid", func() {
+		var unblockGet chan struct{}
+
+		publishDesire := func(processGuid string, instances int) {
+			request := desireAppRequest
+			request.ProcessGuid = processGuid
+			request.NumInstances = instances
+
+			messagePayload, err := json.Marshal(request)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakenats.Publish(desireAppTopic, messagePayload)
+		}
+
+		BeforeEach(func() {
+			unblockGet = make(chan struct{})
+
+			fakeReceptorClient.GetDesiredLRPStub = func(string) (receptor.DesiredLRPResponse, error) {
+				<-unblockGet
+				return receptor.DesiredLRPResponse{}, receptor.Error{Type: receptor.DesiredLRPNotFound}
+			}
+			builder.BuildReturns(&receptor.DesiredLRPCreateRequest{}, nil)
+		})
+
+		AfterEach(func() {
+			select {
+			case <-unblockGet:
+			default:
+				close(unblockGet)
+			}
+		})
+
+		Context("when several desires arrive for one guid", func() {
+			JustBeforeEach(func() {
+				publishDesire("some-guid", 5)
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+
+				publishDesire("some-guid", 3)
+				publishDesire("some-guid", 0)
+			})
+
+			It("handles them one at a time", func() {
+				Consistently(fakeReceptorClient.DeleteDesiredLRPCallCount).Should(Equal(0))
+
+				close(unblockGet)
+
+				Eventually(fakeReceptorClient.DeleteDesiredLRPCallCount).Should(Equal(1))
+			})
+
+			It("drops the superseded desire in favor of the newest", func() {
+				close(unblockGet)
+
+				Eventually(fakeReceptorClient.DeleteDesiredLRPCallCount).Should(Equal(1))
+				Consistently(fakeReceptorClient.CreateDesiredLRPCallCount).Should(Equal(1))
+				Ω(fakeReceptorClient.GetDesiredLRPCallCount()).Should(Equal(2))
+
+				Ω(logger).Should(gbytes.Say("superseded-desire-app"))
+				Ω(metricSender.GetCounter("LRPDesiresSuperseded")).Should(Equal(uint64(1)))
+			})
+		})
+
+		Context("when desires arrive for different guids", func() {
+			JustBeforeEach(func() {
+				publishDesire("some-guid", 5)
+				publishDesire("other-guid", 5)
+			})
+
+			It("handles them in parallel", func() {
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(2))
+			})
+
+			Context("and only one guid may be handled at a time", func() {
+				BeforeEach(func() {
+					runner.MaxInFlight = 1
+				})
+
+				It("waits for the first guid before handling the next", func() {
+					Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+					Consistently(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+
+					close(unblockGet)
+
+					Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(2))
+				})
+			})
+		})
+	})
+
+	Describe("bounding the backlog", func() {
+		var unblockGet chan struct{}
+
+		publishDesire := func(processGuid string) {
+			request := desireAppRequest
+			request.ProcessGuid = processGuid
+
+			messagePayload, err := json.Marshal(request)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakenats.Publish(desireAppTopic, messagePayload)
+		}
+
+		handledGuids := func() []string {
+			guids := []string{}
+			for i := 0; i < fakeReceptorClient.GetDesiredLRPCallCount(); i++ {
+				guids = append(guids, fakeReceptorClient.GetDesiredLRPArgsForCall(i))
+			}
+			return guids
+		}
+
+		BeforeEach(func() {
+			unblockGet = make(chan struct{})
+
+			fakeReceptorClient.GetDesiredLRPStub = func(string) (receptor.DesiredLRPResponse, error) {
+				<-unblockGet
+				return receptor.DesiredLRPResponse{}, receptor.Error{Type: receptor.DesiredLRPNotFound}
+			}
+			builder.BuildReturns(&receptor.DesiredLRPCreateRequest{}, nil)
+
+			runner.MaxInFlight = 1
+			runner.IntakeSize = 1
+			runner.OverflowPolicy = DropNewestOverflowPolicy
+		})
+
+		AfterEach(func() {
+			select {
+			case <-unblockGet:
+			default:
+				close(unblockGet)
+			}
+		})
+
+		Context("when the receptor stalls", func() {
+			JustBeforeEach(func() {
+				publishDesire("guid-1")
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+
+				publishDesire("guid-2")
+				publishDesire("guid-3")
+				publishDesire("guid-4")
+			})
+
+			It("stops taking messages from the intake, so the overflow policy applies", func() {
+				Eventually(func() uint64 {
+					return metricSender.GetCounter("ListenerIntakeDropped")
+				}).Should(Equal(uint64(1)))
+
+				close(unblockGet)
+
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(3))
+				Consistently(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(3))
+			})
+
+			It("counts the queued messages in the depth", func() {
+				Eventually(func() float64 {
+					return metricSender.GetValue("ListenerIntakeQueueDepth").Value
+				}).Should(Equal(float64(2)))
+			})
+
+			It("measures the time messages wait until they are handled", func() {
+				time.Sleep(100 * time.Millisecond)
+				close(unblockGet)
+
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(3))
+				Ω(metricSender.GetValue("ListenerIntakeQueueTime").Value).Should(BeNumerically(">=", float64(100*time.Millisecond)))
+			})
+
+			It("logs the drop", func() {
+				Eventually(logger).Should(gbytes.Say("dropped-message"))
+			})
+
+			Context("and the policy is to drop the oldest message", func() {
+				BeforeEach(func() {
+					runner.OverflowPolicy = DropOldestOverflowPolicy
+				})
+
+				It("makes room for the newest message", func() {
+					Eventually(func() uint64 {
+						return metricSender.GetCounter("ListenerIntakeDropped")
+					}).ShouldNot(BeZero())
+
+					close(unblockGet)
+
+					Eventually(handledGuids).Should(ContainElement("guid-4"))
+					Ω(handledGuids()).Should(ContainElement("guid-1"))
+				})
+			})
+		})
+
+		Context("when the receptor stalls and the policy is to block", func() {
+			var published chan struct{}
+
+			BeforeEach(func() {
+				runner.OverflowPolicy = BlockOverflowPolicy
+			})
+
+			JustBeforeEach(func() {
+				publishDesire("guid-1")
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+
+				publishDesire("guid-2")
+				publishDesire("guid-3")
+
+				published = make(chan struct{})
+				go func() {
+					publishDesire("guid-4")
+					close(published)
+				}()
+			})
+
+			It("waits for room before taking the next message from NATS", func() {
+				Consistently(published).ShouldNot(BeClosed())
+
+				close(unblockGet)
+
+				Eventually(published).Should(BeClosed())
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(4))
+				Ω(metricSender.GetCounter("ListenerIntakeDropped")).Should(Equal(uint64(0)))
+			})
+
+			It("stops waiting once the listener stops", func() {
+				Consistently(published).ShouldNot(BeClosed())
+
+				process.Signal(syscall.SIGINT)
+				Eventually(published).Should(BeClosed())
+
+				close(unblockGet)
+				Eventually(process.Wait()).Should(Receive())
+			})
+		})
+	})
+
+	Describe("when a receptor operation fails", func() {
+		var (
+			fakeClock   *fakeclock.FakeClock
+			deadLetters *fake_deadletter.FakeJournal
+		)
+
+		BeforeEach(func() {
+			fakeClock = fakeclock.NewFakeClock(time.Now())
+			deadLetters = new(fake_deadletter.FakeJournal)
+
+			runner.Clock = fakeClock
+			runner.DeadLetters = deadLetters
+			runner.Retry = RetryPolicy{
+				MaxAttempts:  3,
+				InitialDelay: time.Second,
+				MaxDelay:     time.Minute,
+			}
+
+			fakeReceptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{}, receptor.Error{Type: receptor.DesiredLRPNotFound})
+			builder.BuildReturns(&receptor.DesiredLRPCreateRequest{ProcessGuid: "some-guid"}, nil)
+		})
+
+		JustBeforeEach(func() {
+			messagePayload, err := json.Marshal(desireAppRequest)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakenats.Publish(desireAppTopic, messagePayload)
+		})
+
+		Context("with a transient error", func() {
+			BeforeEach(func() {
+				fakeReceptorClient.CreateDesiredLRPReturns(errors.New("connection refused"))
+			})
+
+			It("retries with backoff until it runs out of attempts", func() {
+				Eventually(fakeReceptorClient.CreateDesiredLRPCallCount).Should(Equal(1))
+				Consistently(fakeReceptorClient.CreateDesiredLRPCallCount).Should(Equal(1))
+
+				Eventually(func() int {
+					fakeClock.Increment(2 * time.Second)
+					return fakeReceptorClient.CreateDesiredLRPCallCount()
+				}).Should(Equal(3))
+
+				Eventually(logger).Should(gbytes.Say("retrying"))
+				Ω(metricSender.GetCounter("ListenerOperationsRetried")).Should(Equal(uint64(2)))
+			})
+
+			It("dead-letters the message", func() {
+				Eventually(func() int {
+					fakeClock.Increment(2 * time.Second)
+					return deadLetters.AppendCallCount()
+				}).Should(Equal(1))
+
+				entry := deadLetters.AppendArgsForCall(0)
+				Ω(entry.Operation).Should(Equal("create"))
+				Ω(entry.ProcessGuid).Should(Equal("some-guid"))
+				Ω(entry.Attempts).Should(Equal(3))
+				Ω(entry.Error).Should(Equal("connection refused"))
+				Ω(entry.DesireApp).Should(Equal(&desireAppRequest))
+				Ω(entry.KillIndex).Should(BeNil())
+
+				Ω(metricSender.GetCounter("ListenerDeadLetters")).Should(Equal(uint64(1)))
+			})
+
+			Context("and a retry succeeds", func() {
+				BeforeEach(func() {
+					fakeReceptorClient.CreateDesiredLRPStub = func(receptor.DesiredLRPCreateRequest) error {
+						if fakeReceptorClient.CreateDesiredLRPCallCount() == 1 {
+							return errors.New("connection refused")
+						}
+						return nil
+					}
+				})
+
+				It("does not dead-letter the message", func() {
+					Eventually(func() int {
+						fakeClock.Increment(2 * time.Second)
+						return fakeReceptorClient.CreateDesiredLRPCallCount()
+					}).Should(Equal(2))
+
+					Consistently(deadLetters.AppendCallCount).Should(Equal(0))
+				})
+			})
+
+			Context("and the listener is stopped while waiting to retry", func() {
+				It("dead-letters the message and exits", func() {
+					Eventually(fakeReceptorClient.CreateDesiredLRPCallCount).Should(Equal(1))
+
+					process.Signal(syscall.SIGINT)
+					Eventually(process.Wait()).Should(Receive())
+
+					Ω(deadLetters.AppendCallCount()).Should(Equal(1))
+					Ω(deadLetters.AppendArgsForCall(0).Attempts).Should(Equal(1))
+				})
+			})
+		})
+
+		Context("when getting the desired LRP of a stop request fails", func() {
+			BeforeEach(func() {
+				desireAppRequest.NumInstances = 0
+
+				fakeReceptorClient.GetDesiredLRPStub = func(string) (receptor.DesiredLRPResponse, error) {
+					if fakeReceptorClient.GetDesiredLRPCallCount() == 1 {
+						return receptor.DesiredLRPResponse{}, errors.New("connection refused")
+					}
+					return receptor.DesiredLRPResponse{ProcessGuid: "some-guid"}, nil
+				}
+			})
+
+			It("retries the get and stops the app", func() {
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+				Consistently(fakeReceptorClient.DeleteDesiredLRPCallCount).Should(Equal(0))
+
+				Eventually(func() int {
+					fakeClock.Increment(2 * time.Second)
+					return fakeReceptorClient.DeleteDesiredLRPCallCount()
+				}).Should(Equal(1))
+
+				Ω(fakeReceptorClient.GetDesiredLRPCallCount()).Should(Equal(2))
+				Ω(fakeReceptorClient.DeleteDesiredLRPArgsForCall(0)).Should(Equal("some-guid"))
+				Ω(deadLetters.AppendCallCount()).Should(Equal(0))
+			})
+
+			Context("on every attempt", func() {
+				BeforeEach(func() {
+					fakeReceptorClient.GetDesiredLRPStub = nil
+					fakeReceptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{}, errors.New("connection refused"))
+				})
+
+				It("dead-letters the stop request", func() {
+					Eventually(func() int {
+						fakeClock.Increment(2 * time.Second)
+						return deadLetters.AppendCallCount()
+					}).Should(Equal(1))
+
+					entry := deadLetters.AppendArgsForCall(0)
+					Ω(entry.Operation).Should(Equal("get"))
+					Ω(entry.Attempts).Should(Equal(3))
+					Ω(entry.DesireApp).Should(Equal(&desireAppRequest))
+					Ω(fakeReceptorClient.DeleteDesiredLRPCallCount()).Should(Equal(0))
+				})
+			})
+		})
+
+		Context("with a permanent error", func() {
+			BeforeEach(func() {
+				fakeReceptorClient.CreateDesiredLRPReturns(receptor.Error{Type: receptor.InvalidRequest, Message: "bad request"})
+			})
+
+			It("dead-letters the message without retrying", func() {
+				Eventually(deadLetters.AppendCallCount).Should(Equal(1))
+				Ω(deadLetters.AppendArgsForCall(0).Attempts).Should(Equal(1))
+				Ω(fakeReceptorClient.CreateDesiredLRPCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("when stopping an index fails", func() {
+			BeforeEach(func() {
+				fakeReceptorClient.KillActualLRPByProcessGuidAndIndexReturns(receptor.Error{Type: receptor.ActualLRPIndexNotFound})
+			})
+
+			It("dead-letters the kill request", func() {
+				killIndexRequest := cc_messages.KillIndexRequestFromCC{ProcessGuid: "some-guid", Index: 1}
+				messagePayload, err := json.Marshal(killIndexRequest)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				fakenats.Publish(stopIndexTopic, messagePayload)
+
+				Eventually(deadLetters.AppendCallCount).Should(Equal(1))
+
+				entry := deadLetters.AppendArgsForCall(0)
+				Ω(entry.Operation).Should(Equal("kill"))
+				Ω(entry.KillIndex).Should(Equal(&killIndexRequest))
+				Ω(entry.DesireApp).Should(BeNil())
+			})
+		})
+	})
+
+	Describe("replying with the outcome of a desire", func() {
+		var results chan DesireAppResult
+
+		publishDesire := func(request cc_messages.DesireAppRequestFromCC) {
+			messagePayload, err := json.Marshal(request)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakenats.PublishWithReplyTo(desireAppTopic, "some-reply-subject", messagePayload)
+		}
+
+		BeforeEach(func() {
+			results = make(chan DesireAppResult, 10)
+
+			_, err := fakenats.Subscribe("some-reply-subject", func(msg *nats.Msg) {
+				result := DesireAppResult{}
+				Ω(json.Unmarshal(msg.Data, &result)).Should(Succeed())
+				results <- result
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeReceptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{}, receptor.Error{Type: receptor.DesiredLRPNotFound})
+			builder.BuildReturns(&receptor.DesiredLRPCreateRequest{}, nil)
+		})
+
+		Context("when the desire is applied", func() {
+			It("replies with success", func() {
+				publishDesire(desireAppRequest)
+
+				Eventually(results).Should(Receive(Equal(DesireAppResult{
+					ProcessGuid: "some-guid",
+					Status:      SuccessStatus,
+				})))
+			})
+		})
+
+		Context("when the built recipe is invalid", func() {
+			BeforeEach(func() {
+				builder.BuildReturns(nil, recipebuilder.ValidationError{
+					errors.New("bad-guid"),
+					errors.New("bad-route"),
+				})
+			})
+
+			It("replies with the validation errors", func() {
+				publishDesire(desireAppRequest)
+
+				var result DesireAppResult
+				Eventually(results).Should(Receive(&result))
+				Ω(result.Status).Should(Equal(ValidationErrorStatus))
+				Ω(result.ValidationErrors).Should(Equal([]string{"bad-guid", "bad-route"}))
+			})
+		})
+
+		Context("when building the recipe fails", func() {
+			BeforeEach(func() {
+				builder.BuildReturns(nil, errors.New("nope"))
+			})
+
+			It("replies with the build error", func() {
+				publishDesire(desireAppRequest)
+
+				Eventually(results).Should(Receive(Equal(DesireAppResult{
+					ProcessGuid: "some-guid",
+					Status:      BuildErrorStatus,
+					Error:       "nope",
+				})))
+			})
+		})
+
+		Context("when the receptor rejects the desire", func() {
+			BeforeEach(func() {
+				fakeReceptorClient.CreateDesiredLRPReturns(receptor.Error{Type: receptor.InvalidRequest, Message: "bad request"})
+			})
+
+			It("replies with the receptor error", func() {
+				publishDesire(desireAppRequest)
+
+				var result DesireAppResult
+				Eventually(results).Should(Receive(&result))
+				Ω(result.Status).Should(Equal(ReceptorErrorStatus))
+				Ω(result.Error).Should(ContainSubstring("bad request"))
+			})
+		})
+
+		Context("when the desire is superseded before it is handled", func() {
+			var unblockGet chan struct{}
+
+			BeforeEach(func() {
+				unblockGet = make(chan struct{})
+
+				fakeReceptorClient.GetDesiredLRPStub = func(string) (receptor.DesiredLRPResponse, error) {
+					<-unblockGet
+					return receptor.DesiredLRPResponse{}, receptor.Error{Type: receptor.DesiredLRPNotFound}
+				}
+			})
+
+			It("replies that the superseded desire was dropped", func() {
+				publishDesire(desireAppRequest)
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+
+				publishDesire(desireAppRequest)
+				publishDesire(desireAppRequest)
+
+				var result DesireAppResult
+				Eventually(results).Should(Receive(&result))
+				Ω(result.Status).Should(Equal(DroppedStatus))
+
+				close(unblockGet)
+
+				Eventually(results).Should(Receive(&result))
+				Ω(result.Status).Should(Equal(SuccessStatus))
+				Eventually(results).Should(Receive(&result))
+				Ω(result.Status).Should(Equal(SuccessStatus))
+			})
+		})
+
+		Context("when desires wait behind a stalled receptor", func() {
+			var unblockGet chan struct{}
+
+			publishDesireFor := func(processGuid string) {
+				request := desireAppRequest
+				request.ProcessGuid = processGuid
+				publishDesire(request)
+			}
+
+			BeforeEach(func() {
+				unblockGet = make(chan struct{})
+
+				fakeReceptorClient.GetDesiredLRPStub = func(string) (receptor.DesiredLRPResponse, error) {
+					<-unblockGet
+					return receptor.DesiredLRPResponse{}, receptor.Error{Type: receptor.DesiredLRPNotFound}
+				}
+
+				runner.MaxInFlight = 1
+				runner.IntakeSize = 1
+				runner.OverflowPolicy = DropNewestOverflowPolicy
+			})
+
+			AfterEach(func() {
+				select {
+				case <-unblockGet:
+				default:
+					close(unblockGet)
+				}
+			})
+
+			JustBeforeEach(func() {
+				publishDesireFor("guid-1")
+				Eventually(fakeReceptorClient.GetDesiredLRPCallCount).Should(Equal(1))
+			})
+
+			It("replies that a desire dropped by the overflow policy was dropped", func() {
+				publishDesireFor("guid-2")
+				publishDesireFor("guid-3")
+				publishDesireFor("guid-4")
+
+				var result DesireAppResult
+				Eventually(results).Should(Receive(&result))
+				Ω(result.Status).Should(Equal(DroppedStatus))
+				Ω(result.Error).Should(ContainSubstring("drop-newest"))
+			})
+
+			It("replies that the pending desires were dropped when the listener stops", func() {
+				publishDesireFor("guid-2")
+				Consistently(results).ShouldNot(Receive())
+
+				process.Signal(syscall.SIGINT)
+
+				var result DesireAppResult
+				Eventually(results).Should(Receive(&result))
+				Ω(result.ProcessGuid).Should(Equal("guid-2"))
+				Ω(result.Status).Should(Equal(DroppedStatus))
+				Ω(result.Error).Should(Equal("the listener is stopping"))
+
+				close(unblockGet)
+				Eventually(process.Wait()).Should(Receive())
+			})
+		})
+
+		Context("when the message has no reply subject", func() {
+			It("does not reply", func() {
+				messagePayload, err := json.Marshal(desireAppRequest)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				fakenats.Publish(desireAppTopic, messagePayload)
+
+				Eventually(fakeReceptorClient.CreateDesiredLRPCallCount).Should(Equal(1))
+				Consistently(results).ShouldNot(Receive())
+			})
+		})
+	})
 })
@@ -0,0 +1,136 @@
+package listen
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+)
+
+// A message is one desire or kill request for a process guid.
+type message struct {
+	processGuid string
+	desire      *cc_messages.DesireAppRequestFromCC
+	kill        *cc_messages.KillIndexRequestFromCC
+
+	// reply is the NATS subject the sender waits on for the outcome, if any.
+	reply string
+
+	// enqueuedAt is when the message entered the intake.
+	enqueuedAt time.Time
+}
+
+// processQueue orders messages by process guid. It hands out at most one
+// message per guid at a time and at most maxInFlight messages overall, and
+// keeps only the newest of the desires pending for a guid. It is not safe
+// for concurrent use.
+type processQueue struct {
+	maxInFlight int
+	inFlight    int
+
+	pending map[string][]message
+	active  map[string]bool
+
+	// waiting lists the guids with pending messages and none in flight, in
+	// the order they became ready.
+	waiting []string
+	queued  map[string]bool
+}
+
+func newProcessQueue(maxInFlight int) *processQueue {
+	return &processQueue{
+		maxInFlight: maxInFlight,
+		pending:     map[string][]message{},
+		active:      map[string]bool{},
+		queued:      map[string]bool{},
+	}
+}
+
+// push adds a message and returns the pending desire it superseded, if any.
+func (q *processQueue) push(msg message) (message, bool) {
+	pending := q.pending[msg.processGuid]
+	var superseded message
+	found := false
+
+	if msg.desire != nil {
+		kept := pending[:0]
+		for _, p := range pending {
+			if p.desire != nil {
+				superseded = p
+				found = true
+				continue
+			}
+			kept = append(kept, p)
+		}
+		pending = kept
+	}
+
+	q.pending[msg.processGuid] = append(pending, msg)
+	q.markWaiting(msg.processGuid)
+
+	return superseded, found
+}
+
+// next returns a message that may be handled now, if there is one.
+func (q *processQueue) next() (message, bool) {
+	if q.inFlight >= q.maxInFlight || len(q.waiting) == 0 {
+		return message{}, false
+	}
+
+	guid := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	delete(q.queued, guid)
+
+	pending := q.pending[guid]
+	msg := pending[0]
+	if len(pending) == 1 {
+		delete(q.pending, guid)
+	} else {
+		q.pending[guid] = pending[1:]
+	}
+
+	q.active[guid] = true
+	q.inFlight++
+
+	return msg, true
+}
+
+// done frees the guid of a message returned by next.
+func (q *processQueue) done(processGuid string) {
+	delete(q.active, processGuid)
+	q.inFlight--
+
+	q.markWaiting(processGuid)
+}
+
+// len is the number of pending messages.
+func (q *processQueue) len() int {
+	count := 0
+	for _, pending := range q.pending {
+		count += len(pending)
+	}
+
+	return count
+}
+
+// drain removes and returns every pending message.
+func (q *processQueue) drain() []message {
+	drained := []message{}
+	for _, pending := range q.pending {
+		drained = append(drained, pending...)
+	}
+
+	q.pending = map[string][]message{}
+	q.waiting = nil
+	q.queued = map[string]bool{}
+
+	return drained
+}
+
+func (q *processQueue) markWaiting(processGuid string) {
+	if q.active[processGuid] || q.queued[processGuid] || len(q.pending[processGuid]) == 0 {
+		return
+	}
+
+	q.waiting = append(q.waiting, processGuid)
+	q.queued[processGuid] = true
+}
@@ -0,0 +1,72 @@
+package listen
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/pivotal-golang/lager"
+)
+
+type ResultStatus string
+
+const (
+	SuccessStatus         ResultStatus = "success"
+	BuildErrorStatus      ResultStatus = "build_error"
+	ValidationErrorStatus ResultStatus = "validation_error"
+	ReceptorErrorStatus   ResultStatus = "receptor_error"
+	// DroppedStatus means the message was not applied because a newer one
+	// for the same app replaced it.
+	DroppedStatus ResultStatus = "dropped"
+)
+
+// A DesireAppResult is published to the reply subject of a desire message
+// once the listener has handled it.
+type DesireAppResult struct {
+	ProcessGuid      string       `json:"process_guid"`
+	Status           ResultStatus `json:"status"`
+	Error            string       `json:"error,omitempty"`
+	ValidationErrors []string     `json:"validation_errors,omitempty"`
+}
+
+func succeeded(processGuid string) DesireAppResult {
+	return DesireAppResult{ProcessGuid: processGuid, Status: SuccessStatus}
+}
+
+func failed(processGuid string, status ResultStatus, err error) DesireAppResult {
+	result := DesireAppResult{
+		ProcessGuid: processGuid,
+		Status:      status,
+		Error:       err.Error(),
+	}
+
+	if validationErr, ok := err.(recipebuilder.ValidationError); ok {
+		result.Status = ValidationErrorStatus
+		result.ValidationErrors = validationErr.Messages()
+	}
+
+	return result
+}
+
+func dropped(processGuid string, reason string) DesireAppResult {
+	return DesireAppResult{ProcessGuid: processGuid, Status: DroppedStatus, Error: reason}
+}
+
+func (listen Listen) reply(subject string, result DesireAppResult) {
+	if subject == "" {
+		return
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		listen.Logger.Error("failed-to-encode-result", err)
+		return
+	}
+
+	err = listen.NATSClient.Publish(subject, payload)
+	if err != nil {
+		listen.Logger.Error("failed-to-reply", err, lager.Data{
+			"process-guid": result.ProcessGuid,
+			"status":       result.Status,
+		})
+	}
+}
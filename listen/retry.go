@@ -0,0 +1,126 @@
+package listen
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/deadletter"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/metric"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	DefaultMaxAttempts       = 5
+	DefaultInitialRetryDelay = 250 * time.Millisecond
+	DefaultMaxRetryDelay     = 10 * time.Second
+
+	retriedOperationCounter = metric.Counter("ListenerOperationsRetried")
+	deadLetterCounter       = metric.Counter("ListenerDeadLetters")
+)
+
+// A RetryPolicy retries receptor operations that fail with transient errors,
+// backing off exponentially with jitter. Its zero value tries once.
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// delay picks the wait before the next attempt at random from the upper
+// half of the exponential backoff, so listeners do not retry in lockstep.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	backoff := p.InitialDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || backoff < p.MaxDelay); i++ {
+		backoff *= 2
+	}
+
+	if p.MaxDelay != 0 && backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// isTransient is true for errors that may go away on their own: failures to
+// reach the receptor and errors the receptor could not classify.
+func isTransient(err error) bool {
+	rerr, ok := err.(receptor.Error)
+	if !ok {
+		return true
+	}
+
+	return rerr.Type == receptor.UnknownError || rerr.Type == receptor.ResourceConflict
+}
+
+// retry runs the operation until it succeeds, fails permanently, or runs out
+// of attempts. Messages whose operation finally fails are dead-lettered.
+func (listen Listen) retry(logger lager.Logger, operation string, msg message, attempt func() error) error {
+	maxAttempts := listen.Retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for attempts := 1; ; attempts++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		if !isTransient(err) || attempts >= maxAttempts {
+			listen.deadLetter(logger, operation, msg, attempts, err)
+			return err
+		}
+
+		delay := listen.Retry.delay(attempts)
+		logger.Info("retrying", lager.Data{
+			"operation": operation,
+			"attempt":   attempts,
+			"delay":     delay.String(),
+			"error":     err.Error(),
+		})
+		retriedOperationCounter.Increment()
+
+		timer := listen.Clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-listen.stopping:
+			timer.Stop()
+			listen.deadLetter(logger, operation, msg, attempts, err)
+			return err
+		}
+	}
+}
+
+func (listen Listen) deadLetter(logger lager.Logger, operation string, msg message, attempts int, err error) {
+	if listen.DeadLetters == nil {
+		return
+	}
+
+	entry := deadletter.Entry{
+		Time:        listen.Clock.Now(),
+		ProcessGuid: msg.processGuid,
+		Operation:   operation,
+		Attempts:    attempts,
+		Error:       err.Error(),
+		DesireApp:   msg.desire,
+		KillIndex:   msg.kill,
+	}
+
+	journalErr := listen.DeadLetters.Append(entry)
+	if journalErr != nil {
+		logger.Error("failed-to-dead-letter", journalErr, lager.Data{"operation": operation})
+		return
+	}
+
+	logger.Info("dead-lettered", lager.Data{
+		"operation": operation,
+		"attempts":  attempts,
+	})
+	deadLetterCounter.Increment()
+}
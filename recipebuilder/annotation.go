@@ -0,0 +1,85 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RecipeVersion identifies the format of the recipes this builder produces.
+// Bump it whenever a change to the builder should rebuild existing LRPs.
+const RecipeVersion = "1"
+
+// An Annotation is stored on every desired LRP so nsync can tell whether the
+// LRP is out of date, either because CC changed the app or because the LRP
+// was built by an older recipe builder.
+type Annotation struct {
+	ETag          string `json:"etag"`
+	RecipeVersion string `json:"recipe_version"`
+
+	// UpdatedAt orders the states of an app; it is zero when unknown.
+	UpdatedAt float64 `json:"updated_at,omitempty"`
+}
+
+func NewAnnotation(etag string) Annotation {
+	return Annotation{
+		ETag:          etag,
+		RecipeVersion: RecipeVersion,
+		UpdatedAt:     etagTimestamp(etag),
+	}
+}
+
+// ParseAnnotation reads both structured annotations and the plain CC ETags
+// older versions of nsync stored. The latter have no recipe version.
+func ParseAnnotation(annotation string) Annotation {
+	if strings.HasPrefix(annotation, "{") {
+		parsed := Annotation{}
+		err := json.Unmarshal([]byte(annotation), &parsed)
+		if err == nil {
+			if parsed.UpdatedAt == 0 {
+				parsed.UpdatedAt = etagTimestamp(parsed.ETag)
+			}
+			return parsed
+		}
+	}
+
+	return Annotation{ETag: annotation, UpdatedAt: etagTimestamp(annotation)}
+}
+
+func (a Annotation) String() string {
+	encoded, err := json.Marshal(a)
+	if err != nil {
+		panic("failed to encode annotation: " + err.Error())
+	}
+
+	return string(encoded)
+}
+
+// IsLegacy reports whether the annotation is a plain ETag stored before nsync
+// versioned its recipes.
+func (a Annotation) IsLegacy() bool {
+	return a.RecipeVersion == ""
+}
+
+// IsCurrentRecipe reports whether the LRP was built by this recipe builder.
+func (a Annotation) IsCurrentRecipe() bool {
+	return a.RecipeVersion == RecipeVersion
+}
+
+// OlderThan reports whether the annotation describes an earlier state of the
+// app than other does. Annotations without timestamps cannot be ordered and
+// are never older.
+func (a Annotation) OlderThan(other Annotation) bool {
+	return a.UpdatedAt > 0 && other.UpdatedAt > 0 && a.UpdatedAt < other.UpdatedAt
+}
+
+// etagTimestamp reads the updated-at time CC uses as an app's ETag.
+func etagTimestamp(etag string) float64 {
+	timestamp, err := strconv.ParseFloat(etag, 64)
+	if err != nil || timestamp < 0 || math.IsNaN(timestamp) || math.IsInf(timestamp, 0) {
+		return 0
+	}
+
+	return timestamp
+}
@@ -0,0 +1,70 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Annotation", func() {
+	It("round-trips the etag and the recipe version", func() {
+		annotation := recipebuilder.NewAnnotation("1234.5")
+
+		parsed := recipebuilder.ParseAnnotation(annotation.String())
+		Ω(parsed).Should(Equal(recipebuilder.Annotation{
+			ETag:          "1234.5",
+			RecipeVersion: recipebuilder.RecipeVersion,
+			UpdatedAt:     1234.5,
+		}))
+		Ω(parsed.IsCurrentRecipe()).Should(BeTrue())
+	})
+
+	It("reads plain etags as annotations from an older recipe builder", func() {
+		parsed := recipebuilder.ParseAnnotation("1234.5")
+		Ω(parsed).Should(Equal(recipebuilder.Annotation{ETag: "1234.5", UpdatedAt: 1234.5}))
+		Ω(parsed.IsCurrentRecipe()).Should(BeFalse())
+		Ω(parsed.IsLegacy()).Should(BeTrue())
+	})
+
+	It("reads malformed structured annotations as plain etags", func() {
+		parsed := recipebuilder.ParseAnnotation(`{"etag"`)
+		Ω(parsed).Should(Equal(recipebuilder.Annotation{ETag: `{"etag"`}))
+	})
+
+	It("does not treat a different recipe version as current", func() {
+		parsed := recipebuilder.ParseAnnotation(`{"etag":"1234.5","recipe_version":"0"}`)
+		Ω(parsed.ETag).Should(Equal("1234.5"))
+		Ω(parsed.IsCurrentRecipe()).Should(BeFalse())
+		Ω(parsed.IsLegacy()).Should(BeFalse())
+	})
+
+	Describe("ordering", func() {
+		It("takes the updated-at time from CC's etag", func() {
+			Ω(recipebuilder.NewAnnotation("1429893726.38").UpdatedAt).Should(Equal(1429893726.38))
+			Ω(recipebuilder.NewAnnotation("some-etag").UpdatedAt).Should(BeZero())
+		})
+
+		It("fills in the time of structured annotations written without one", func() {
+			parsed := recipebuilder.ParseAnnotation(`{"etag":"1234.5","recipe_version":"1"}`)
+			Ω(parsed.UpdatedAt).Should(Equal(1234.5))
+		})
+
+		It("orders annotations by their updated-at time", func() {
+			older := recipebuilder.NewAnnotation("1000.5")
+			newer := recipebuilder.NewAnnotation("1000.75")
+
+			Ω(older.OlderThan(newer)).Should(BeTrue())
+			Ω(newer.OlderThan(older)).Should(BeFalse())
+			Ω(older.OlderThan(older)).Should(BeFalse())
+		})
+
+		It("never treats annotations without a time as older", func() {
+			unknown := recipebuilder.NewAnnotation("some-etag")
+			known := recipebuilder.NewAnnotation("1000.5")
+
+			Ω(unknown.OlderThan(known)).Should(BeFalse())
+			Ω(known.OlderThan(unknown)).Should(BeFalse())
+		})
+	})
+})
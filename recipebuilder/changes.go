@@ -0,0 +1,60 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+
+	"github.com/cloudfoundry-incubator/receptor"
+)
+
+// NonUpdatableChanges names the fields of the desired LRP that differ from the
+// existing one and that a DesiredLRPUpdateRequest cannot change. An LRP with
+// such changes has to be replaced for them to take effect.
+func NonUpdatableChanges(existing receptor.DesiredLRPResponse, desired *receptor.DesiredLRPCreateRequest) []string {
+	changes := []string{}
+
+	changed := func(field string, same bool) {
+		if !same {
+			changes = append(changes, field)
+		}
+	}
+
+	changed("domain", existing.Domain == desired.Domain)
+	changed("rootfs", existing.RootFSPath == desired.RootFSPath)
+	changed("stack", existing.Stack == desired.Stack)
+	changed("env", sameJSON(existing.EnvironmentVariables, desired.EnvironmentVariables))
+	changed("setup", sameJSON(existing.Setup, desired.Setup))
+	changed("action", sameJSON(existing.Action, desired.Action))
+	changed("monitor", sameJSON(existing.Monitor, desired.Monitor))
+	changed("start_timeout", existing.StartTimeout == desired.StartTimeout)
+	changed("disk_mb", existing.DiskMB == desired.DiskMB)
+	changed("memory_mb", existing.MemoryMB == desired.MemoryMB)
+	changed("cpu_weight", existing.CPUWeight == desired.CPUWeight)
+	changed("privileged", existing.Privileged == desired.Privileged)
+	changed("ports", sameJSON(existing.Ports, desired.Ports))
+	changed("log_guid", existing.LogGuid == desired.LogGuid)
+	changed("log_source", existing.LogSource == desired.LogSource)
+	changed("metrics_guid", existing.MetricsGuid == desired.MetricsGuid)
+	changed("egress_rules", sameJSON(existing.EgressRules, desired.EgressRules))
+
+	return changes
+}
+
+// sameJSON compares values the way the receptor stores them, so that e.g. a
+// nil and an empty list are the same.
+func sameJSON(a, b interface{}) bool {
+	return normalizedJSON(a) == normalizedJSON(b)
+}
+
+func normalizedJSON(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		panic("failed to encode desired LRP field: " + err.Error())
+	}
+
+	switch string(encoded) {
+	case "null", "[]", "{}":
+		return ""
+	}
+
+	return string(encoded)
+}
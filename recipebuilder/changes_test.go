@@ -0,0 +1,83 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NonUpdatableChanges", func() {
+	var (
+		existing receptor.DesiredLRPResponse
+		desired  receptor.DesiredLRPCreateRequest
+	)
+
+	BeforeEach(func() {
+		existing = receptor.DesiredLRPResponse{
+			ProcessGuid: "the-app-guid",
+			Instances:   2,
+			Stack:       "some-stack",
+			MemoryMB:    128,
+			DiskMB:      512,
+			Ports:       []uint16{8080},
+			Action: &models.RunAction{
+				Path: "/tmp/lifecycle/launcher",
+				Args: []string{"/app", "the-start-command", ""},
+				Env:  []models.EnvironmentVariable{{Name: "PORT", Value: "8080"}},
+			},
+			Annotation: "old-annotation",
+		}
+
+		desired = receptor.DesiredLRPCreateRequest{
+			ProcessGuid: "the-app-guid",
+			Instances:   5,
+			Stack:       "some-stack",
+			MemoryMB:    128,
+			DiskMB:      512,
+			Ports:       []uint16{8080},
+			Action: &models.RunAction{
+				Path: "/tmp/lifecycle/launcher",
+				Args: []string{"/app", "the-start-command", ""},
+				Env:  []models.EnvironmentVariable{{Name: "PORT", Value: "8080"}},
+			},
+			Annotation: "new-annotation",
+		}
+	})
+
+	It("ignores fields that can be updated in place", func() {
+		Ω(recipebuilder.NonUpdatableChanges(existing, &desired)).Should(BeEmpty())
+	})
+
+	It("treats missing and empty lists as the same", func() {
+		existing.EgressRules = nil
+		desired.EgressRules = []models.SecurityGroupRule{}
+
+		Ω(recipebuilder.NonUpdatableChanges(existing, &desired)).Should(BeEmpty())
+	})
+
+	It("reports changes to resources", func() {
+		desired.MemoryMB = 256
+		desired.DiskMB = 1024
+
+		Ω(recipebuilder.NonUpdatableChanges(existing, &desired)).Should(Equal([]string{"disk_mb", "memory_mb"}))
+	})
+
+	It("reports changes to the action, such as a new start command or environment", func() {
+		desired.Action = &models.RunAction{
+			Path: "/tmp/lifecycle/launcher",
+			Args: []string{"/app", "a-new-start-command", ""},
+			Env:  []models.EnvironmentVariable{{Name: "PORT", Value: "8080"}},
+		}
+
+		Ω(recipebuilder.NonUpdatableChanges(existing, &desired)).Should(Equal([]string{"action"}))
+	})
+
+	It("reports changes to the setup, such as a new droplet", func() {
+		desired.Setup = &models.DownloadAction{From: "http://new-droplet.uri.com", To: "."}
+
+		Ω(recipebuilder.NonUpdatableChanges(existing, &desired)).Should(Equal([]string{"setup"}))
+	})
+})
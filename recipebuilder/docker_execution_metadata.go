@@ -0,0 +1,112 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type DockerPortRule string
+
+const (
+	// FirstExposedPort picks the first tcp port in the order the image lists them.
+	FirstExposedPort DockerPortRule = "first"
+	// LowestExposedPort picks the numerically lowest tcp port.
+	LowestExposedPort DockerPortRule = "lowest"
+	// SingleExposedPort requires the image to expose exactly one tcp port.
+	SingleExposedPort DockerPortRule = "single"
+
+	DefaultDockerPortRule = FirstExposedPort
+)
+
+var (
+	ErrInvalidExecutionMetadata = errors.New("docker execution metadata is not valid json")
+	ErrInvalidExposedPort       = errors.New("docker image exposes an invalid port")
+	ErrAmbiguousExposedPorts    = errors.New("docker image exposes several tcp ports; exactly one is required")
+)
+
+type DockerExecutionMetadata struct {
+	Cmd          []string     `json:"cmd,omitempty"`
+	Entrypoint   []string     `json:"entrypoint,omitempty"`
+	Workdir      string       `json:"workdir,omitempty"`
+	ExposedPorts []DockerPort `json:"ports,omitempty"`
+}
+
+type DockerPort struct {
+	Port     uint32 `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+func ParseDockerPortRule(rule string) (DockerPortRule, error) {
+	switch DockerPortRule(rule) {
+	case FirstExposedPort, LowestExposedPort, SingleExposedPort:
+		return DockerPortRule(rule), nil
+	}
+
+	return "", fmt.Errorf("unknown docker port rule %q; expected one of first, lowest or single", rule)
+}
+
+func parseDockerExecutionMetadata(executionMetadata string) (DockerExecutionMetadata, error) {
+	metadata := DockerExecutionMetadata{}
+	if executionMetadata == "" {
+		return metadata, nil
+	}
+
+	err := json.Unmarshal([]byte(executionMetadata), &metadata)
+	if err != nil {
+		return DockerExecutionMetadata{}, ErrInvalidExecutionMetadata
+	}
+
+	return metadata, nil
+}
+
+// exposedTCPPorts returns the image's tcp ports, in the order the image lists
+// them. Ports without a protocol are tcp, as they are for `docker run`.
+func (m DockerExecutionMetadata) exposedTCPPorts() ([]uint16, error) {
+	ports := []uint16{}
+
+	for _, exposed := range m.ExposedPorts {
+		if exposed.Port == 0 || exposed.Port > 65535 {
+			return nil, ErrInvalidExposedPort
+		}
+
+		switch strings.ToLower(exposed.Protocol) {
+		case "", "tcp":
+			ports = append(ports, uint16(exposed.Port))
+		case "udp":
+		default:
+			return nil, ErrInvalidExposedPort
+		}
+	}
+
+	return ports, nil
+}
+
+// selectPort picks the port the app is reached on, or DefaultPort when the
+// image exposes no tcp port.
+func (rule DockerPortRule) selectPort(ports []uint16) (uint16, error) {
+	if len(ports) == 0 {
+		return DefaultPort, nil
+	}
+
+	switch rule {
+	case LowestExposedPort:
+		sorted := make([]int, len(ports))
+		for i, port := range ports {
+			sorted[i] = int(port)
+		}
+		sort.Ints(sorted)
+		return uint16(sorted[0]), nil
+
+	case SingleExposedPort:
+		if len(ports) > 1 {
+			return 0, ErrAmbiguousExposedPorts
+		}
+		return ports[0], nil
+
+	default:
+		return ports[0], nil
+	}
+}
@@ -0,0 +1,139 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Docker Execution Metadata", func() {
+	Describe("ParseDockerPortRule", func() {
+		It("accepts the known rules", func() {
+			for _, rule := range []string{"first", "lowest", "single"} {
+				parsed, err := recipebuilder.ParseDockerPortRule(rule)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(parsed).Should(Equal(recipebuilder.DockerPortRule(rule)))
+			}
+		})
+
+		It("rejects unknown rules", func() {
+			_, err := recipebuilder.ParseDockerPortRule("highest")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("choosing the port of a docker app", func() {
+		var (
+			rule       recipebuilder.DockerPortRule
+			desiredApp cc_messages.DesireAppRequestFromCC
+			ports      []uint16
+			err        error
+		)
+
+		BeforeEach(func() {
+			rule = recipebuilder.FirstExposedPort
+			desiredApp = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:       "the-app-guid",
+				DockerImageUrl:    "user/repo",
+				ExecutionMetadata: `{"ports":[{"port":9091,"protocol":"udp"},{"port":9092},{"port":9090,"protocol":"tcp"}]}`,
+			}
+		})
+
+		JustBeforeEach(func() {
+			builder := recipebuilder.New(recipebuilder.Config{DockerPortRule: rule}, lager.NewLogger("fakelogger"))
+			ports, err = builder.Ports(&desiredApp)
+		})
+
+		It("uses the first exposed tcp port", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ports).Should(Equal([]uint16{9092}))
+		})
+
+		Context("when the rule is lowest", func() {
+			BeforeEach(func() {
+				rule = recipebuilder.LowestExposedPort
+			})
+
+			It("uses the lowest exposed tcp port", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ports).Should(Equal([]uint16{9090}))
+			})
+		})
+
+		Context("when the rule is single", func() {
+			BeforeEach(func() {
+				rule = recipebuilder.SingleExposedPort
+			})
+
+			It("refuses images that expose several tcp ports", func() {
+				Ω(err).Should(MatchError(recipebuilder.ErrAmbiguousExposedPorts))
+			})
+
+			Context("and the image exposes one tcp port", func() {
+				BeforeEach(func() {
+					desiredApp.ExecutionMetadata = `{"ports":[{"port":53,"protocol":"udp"},{"port":9090,"protocol":"tcp"}]}`
+				})
+
+				It("uses it", func() {
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(ports).Should(Equal([]uint16{9090}))
+				})
+			})
+		})
+
+		Context("when the image exposes no tcp port", func() {
+			BeforeEach(func() {
+				desiredApp.ExecutionMetadata = `{"ports":[{"port":53,"protocol":"udp"}]}`
+			})
+
+			It("uses the default port", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ports).Should(Equal([]uint16{8080}))
+			})
+		})
+
+		Context("when there is no execution metadata", func() {
+			BeforeEach(func() {
+				desiredApp.ExecutionMetadata = ""
+			})
+
+			It("uses the default port", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ports).Should(Equal([]uint16{8080}))
+			})
+		})
+
+		Context("when the execution metadata is not json", func() {
+			BeforeEach(func() {
+				desiredApp.ExecutionMetadata = "the-execution-metadata"
+			})
+
+			It("errors", func() {
+				Ω(err).Should(MatchError(recipebuilder.ErrInvalidExecutionMetadata))
+			})
+		})
+
+		Context("when an exposed port is out of range", func() {
+			BeforeEach(func() {
+				desiredApp.ExecutionMetadata = `{"ports":[{"port":70000,"protocol":"tcp"}]}`
+			})
+
+			It("errors", func() {
+				Ω(err).Should(MatchError(recipebuilder.ErrInvalidExposedPort))
+			})
+		})
+
+		Context("when an exposed port has an unknown protocol", func() {
+			BeforeEach(func() {
+				desiredApp.ExecutionMetadata = `{"ports":[{"port":9090,"protocol":"sctp"}]}`
+			})
+
+			It("errors", func() {
+				Ω(err).Should(MatchError(recipebuilder.ErrInvalidExposedPort))
+			})
+		})
+	})
+})
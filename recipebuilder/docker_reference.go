@@ -0,0 +1,131 @@
+package recipebuilder
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const maxDockerNameLength = 255
+
+var (
+	dockerPathComponent = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	dockerTag           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	dockerDigest        = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+	dockerRegistryHost  = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+)
+
+type InvalidDockerReferenceError struct {
+	Reference string
+	Reason    string
+}
+
+func (e InvalidDockerReferenceError) Error() string {
+	return fmt.Sprintf("invalid docker image reference %q: %s", e.Reference, e.Reason)
+}
+
+// DockerReference is a parsed docker image reference of the form
+// [registry[:port]/]repository[:tag][@digest].
+type DockerReference struct {
+	// Registry is empty for images on the default registry.
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// via https://github.com/docker/distribution/blob/master/reference/regexp.go
+func ParseDockerReference(reference string) (DockerReference, error) {
+	invalid := func(reason string) (DockerReference, error) {
+		return DockerReference{}, InvalidDockerReferenceError{Reference: reference, Reason: reason}
+	}
+
+	parsed := DockerReference{}
+	name := reference
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		parsed.Digest = name[i+1:]
+		name = name[:i]
+
+		if !dockerDigest.MatchString(parsed.Digest) {
+			return invalid("malformed digest")
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		parsed.Tag = name[i+1:]
+		name = name[:i]
+
+		if !dockerTag.MatchString(parsed.Tag) {
+			return invalid("malformed tag")
+		}
+	}
+
+	if i := strings.Index(name, "/"); i >= 0 && isDockerRegistry(name[:i]) {
+		parsed.Registry = name[:i]
+		name = name[i+1:]
+
+		if !dockerRegistryHost.MatchString(parsed.Registry) {
+			return invalid("malformed registry host")
+		}
+	}
+
+	if name == "" {
+		return invalid("missing repository")
+	}
+
+	if len(name) > maxDockerNameLength {
+		return invalid(fmt.Sprintf("repository is longer than %d characters", maxDockerNameLength))
+	}
+
+	for _, component := range strings.Split(name, "/") {
+		if !dockerPathComponent.MatchString(component) {
+			return invalid(fmt.Sprintf("malformed repository path component %q", component))
+		}
+	}
+
+	parsed.Repository = name
+
+	return parsed, nil
+}
+
+func (r DockerReference) String() string {
+	name := r.Repository
+	if r.Registry != "" {
+		name = r.Registry + "/" + name
+	}
+
+	if r.Tag != "" {
+		name += ":" + r.Tag
+	}
+
+	if r.Digest != "" {
+		name += "@" + r.Digest
+	}
+
+	return name
+}
+
+// RootFSPath maps the reference to the rootfs url garden understands. The
+// registry becomes the url host, and a digest, which pins the exact image,
+// takes precedence over a tag.
+func (r DockerReference) RootFSPath() string {
+	fragment := r.Tag
+	if r.Digest != "" {
+		fragment = r.Digest
+	}
+
+	return (&url.URL{
+		Scheme:   DockerScheme,
+		Host:     r.Registry,
+		Path:     "/" + r.Repository,
+		Fragment: fragment,
+	}).String()
+}
+
+// the first path component names a registry only if it looks like a host;
+// otherwise it is the user or organisation on the default registry
+func isDockerRegistry(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
@@ -0,0 +1,88 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const imageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+var _ = Describe("Docker References", func() {
+	type validReference struct {
+		description string
+		reference   string
+		parsed      recipebuilder.DockerReference
+		rootFSPath  string
+	}
+
+	validReferences := []validReference{
+		{"an official image", "ubuntu",
+			recipebuilder.DockerReference{Repository: "ubuntu"},
+			"docker:///ubuntu"},
+		{"a user image", "user/repo",
+			recipebuilder.DockerReference{Repository: "user/repo"},
+			"docker:///user/repo"},
+		{"a tag", "user/repo:tag",
+			recipebuilder.DockerReference{Repository: "user/repo", Tag: "tag"},
+			"docker:///user/repo#tag"},
+		{"a registry host", "docker.example.com/org/repo",
+			recipebuilder.DockerReference{Registry: "docker.example.com", Repository: "org/repo"},
+			"docker://docker.example.com/org/repo"},
+		{"a registry host and port", "registry:5000/org/img",
+			recipebuilder.DockerReference{Registry: "registry:5000", Repository: "org/img"},
+			"docker://registry:5000/org/img"},
+		{"a registry port and a tag", "registry:5000/org/img:1.0",
+			recipebuilder.DockerReference{Registry: "registry:5000", Repository: "org/img", Tag: "1.0"},
+			"docker://registry:5000/org/img#1.0"},
+		{"localhost", "localhost/img",
+			recipebuilder.DockerReference{Registry: "localhost", Repository: "img"},
+			"docker://localhost/img"},
+		{"a digest", "registry:5000/org/img@" + imageDigest,
+			recipebuilder.DockerReference{Registry: "registry:5000", Repository: "org/img", Digest: imageDigest},
+			"docker://registry:5000/org/img#" + imageDigest},
+		{"a tag and a digest", "img:tag@" + imageDigest,
+			recipebuilder.DockerReference{Repository: "img", Tag: "tag", Digest: imageDigest},
+			"docker:///img#" + imageDigest},
+		{"a deep repository path", "gcr.io/project/team/img_name.v2:latest",
+			recipebuilder.DockerReference{Registry: "gcr.io", Repository: "project/team/img_name.v2", Tag: "latest"},
+			"docker://gcr.io/project/team/img_name.v2#latest"},
+	}
+
+	for _, valid := range validReferences {
+		valid := valid
+
+		It("parses "+valid.description, func() {
+			parsed, err := recipebuilder.ParseDockerReference(valid.reference)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(parsed).Should(Equal(valid.parsed))
+			Ω(parsed.RootFSPath()).Should(Equal(valid.rootFSPath))
+		})
+	}
+
+	invalidReferences := []struct {
+		description string
+		reference   string
+	}{
+		{"an empty reference", ""},
+		{"a missing repository", ":tag"},
+		{"a registry without a repository", "registry:5000/"},
+		{"upper case repositories", "User/Repo"},
+		{"an empty tag", "user/repo:"},
+		{"a malformed tag", "user/repo:-tag"},
+		{"a malformed digest", "user/repo@sha256:abc"},
+		{"an empty path component", "user//repo"},
+		{"a scheme", "https://docker.com/docker"},
+	}
+
+	for _, invalid := range invalidReferences {
+		invalid := invalid
+
+		It("rejects "+invalid.description, func() {
+			_, err := recipebuilder.ParseDockerReference(invalid.reference)
+			Ω(err).Should(BeAssignableToTypeOf(recipebuilder.InvalidDockerReferenceError{}))
+			Ω(err.Error()).Should(ContainSubstring(invalid.reference))
+		})
+	}
+})
@@ -0,0 +1,118 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	DockerHubRegistry = "docker.io"
+	AnyDockerRegistry = "*"
+
+	dockerHubOfficialNamespace = "library"
+)
+
+var dockerHubAliases = []string{"", DockerHubRegistry, "index.docker.io", "registry-1.docker.io"}
+
+type DeniedDockerImageError struct {
+	Reference string
+	Registry  string
+}
+
+func (e DeniedDockerImageError) Error() string {
+	return fmt.Sprintf("docker image %q comes from denied registry %q", e.Reference, e.Registry)
+}
+
+// A DockerRegistryRule either redirects the images of a registry to a mirror,
+// or denies them outright. Registry "*" matches every registry.
+type DockerRegistryRule struct {
+	Registry string `json:"registry"`
+	Mirror   string `json:"mirror,omitempty"`
+	Deny     bool   `json:"deny,omitempty"`
+}
+
+// DockerRegistryRules are evaluated in order; the first matching rule wins.
+type DockerRegistryRules []DockerRegistryRule
+
+func ParseDockerRegistryRules(rules string) (DockerRegistryRules, error) {
+	if strings.TrimSpace(rules) == "" {
+		return nil, nil
+	}
+
+	parsed := DockerRegistryRules{}
+	err := json.Unmarshal([]byte(rules), &parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, rule := range parsed {
+		if rule.Registry == "" {
+			return nil, fmt.Errorf("docker registry rule %d: registry is required", i)
+		}
+
+		if rule.Deny == (rule.Mirror != "") {
+			return nil, fmt.Errorf("docker registry rule %d: exactly one of mirror or deny is required", i)
+		}
+
+		if rule.Mirror != "" && !dockerRegistryHost.MatchString(rule.Mirror) {
+			return nil, fmt.Errorf("docker registry rule %d: malformed mirror host %q", i, rule.Mirror)
+		}
+	}
+
+	return parsed, nil
+}
+
+func (rules DockerRegistryRules) Rewrite(reference DockerReference) (DockerReference, error) {
+	for _, rule := range rules {
+		if !rule.matches(reference.Registry) {
+			continue
+		}
+
+		if rule.Deny {
+			return DockerReference{}, DeniedDockerImageError{
+				Reference: reference.String(),
+				Registry:  canonicalRegistry(reference.Registry),
+			}
+		}
+
+		mirrored := reference
+		mirrored.Registry = rule.Mirror
+
+		// the hub serves official images from an implicit namespace that a
+		// mirror has to be asked for explicitly
+		if isDockerHub(reference.Registry) && !strings.Contains(reference.Repository, "/") {
+			mirrored.Repository = dockerHubOfficialNamespace + "/" + reference.Repository
+		}
+
+		return mirrored, nil
+	}
+
+	return reference, nil
+}
+
+func (rule DockerRegistryRule) matches(registry string) bool {
+	if rule.Registry == AnyDockerRegistry {
+		return true
+	}
+
+	return canonicalRegistry(rule.Registry) == canonicalRegistry(registry)
+}
+
+func canonicalRegistry(registry string) string {
+	if isDockerHub(registry) {
+		return DockerHubRegistry
+	}
+
+	return registry
+}
+
+func isDockerHub(registry string) bool {
+	for _, alias := range dockerHubAliases {
+		if registry == alias {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,114 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Docker Registry Rules", func() {
+	Describe("ParseDockerRegistryRules", func() {
+		It("parses an ordered list of rules", func() {
+			rules, err := recipebuilder.ParseDockerRegistryRules(`[
+				{"registry": "docker.io", "mirror": "mirror.internal:5000"},
+				{"registry": "evil.example.com", "deny": true}
+			]`)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rules).Should(Equal(recipebuilder.DockerRegistryRules{
+				{Registry: "docker.io", Mirror: "mirror.internal:5000"},
+				{Registry: "evil.example.com", Deny: true},
+			}))
+		})
+
+		It("allows no rules", func() {
+			rules, err := recipebuilder.ParseDockerRegistryRules("")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rules).Should(BeEmpty())
+		})
+
+		It("rejects malformed json", func() {
+			_, err := recipebuilder.ParseDockerRegistryRules(`{"registry"`)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects rules without a registry", func() {
+			_, err := recipebuilder.ParseDockerRegistryRules(`[{"mirror": "mirror.internal"}]`)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects rules that both mirror and deny", func() {
+			_, err := recipebuilder.ParseDockerRegistryRules(`[{"registry": "docker.io", "mirror": "mirror.internal", "deny": true}]`)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects rules that neither mirror nor deny", func() {
+			_, err := recipebuilder.ParseDockerRegistryRules(`[{"registry": "docker.io"}]`)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects malformed mirror hosts", func() {
+			_, err := recipebuilder.ParseDockerRegistryRules(`[{"registry": "docker.io", "mirror": "http://mirror.internal"}]`)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Rewrite", func() {
+		var rules recipebuilder.DockerRegistryRules
+
+		rewrite := func(image string) (string, error) {
+			reference, err := recipebuilder.ParseDockerReference(image)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			rewritten, err := rules.Rewrite(reference)
+			return rewritten.String(), err
+		}
+
+		BeforeEach(func() {
+			rules = recipebuilder.DockerRegistryRules{
+				{Registry: "evil.example.com", Deny: true},
+				{Registry: "docker.io", Mirror: "mirror.internal:5000"},
+				{Registry: "quay.io", Mirror: "quay-mirror.internal"},
+			}
+		})
+
+		It("mirrors docker hub images, however the hub is named", func() {
+			Ω(rewrite("user/repo:tag")).Should(Equal("mirror.internal:5000/user/repo:tag"))
+			Ω(rewrite("index.docker.io/user/repo")).Should(Equal("mirror.internal:5000/user/repo"))
+			Ω(rewrite("docker.io/user/repo@" + imageDigest)).Should(Equal("mirror.internal:5000/user/repo@" + imageDigest))
+		})
+
+		It("asks the mirror for official hub images by their full name", func() {
+			Ω(rewrite("ubuntu:14.04")).Should(Equal("mirror.internal:5000/library/ubuntu:14.04"))
+		})
+
+		It("mirrors other registries", func() {
+			Ω(rewrite("quay.io/org/repo")).Should(Equal("quay-mirror.internal/org/repo"))
+		})
+
+		It("leaves unmatched registries alone", func() {
+			Ω(rewrite("registry.example.com:5000/org/repo")).Should(Equal("registry.example.com:5000/org/repo"))
+		})
+
+		It("refuses images from denied registries", func() {
+			_, err := rewrite("evil.example.com/org/repo")
+			Ω(err).Should(MatchError(recipebuilder.DeniedDockerImageError{
+				Reference: "evil.example.com/org/repo",
+				Registry:  "evil.example.com",
+			}))
+		})
+
+		Context("with a catch-all rule", func() {
+			BeforeEach(func() {
+				rules = append(rules, recipebuilder.DockerRegistryRule{Registry: "*", Deny: true})
+			})
+
+			It("applies it to registries no earlier rule matched", func() {
+				_, err := rewrite("registry.example.com/org/repo")
+				Ω(err).Should(BeAssignableToTypeOf(recipebuilder.DeniedDockerImageError{}))
+
+				Ω(rewrite("user/repo")).Should(Equal("mirror.internal:5000/user/repo"))
+			})
+		})
+	})
+})
@@ -0,0 +1,58 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+)
+
+// LoadDefaultEgressRules reads the operator's baseline egress rules from a
+// JSON list of security group rules, rejecting any rule that is invalid.
+func LoadDefaultEgressRules(path string) ([]models.SecurityGroupRule, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []models.SecurityGroupRule{}
+	err = json.Unmarshal(contents, &rules)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, rule := range rules {
+		err := rule.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("default egress rule %d: %s", i, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// mergeEgressRules puts the default rules ahead of the app's, dropping any
+// rule that appears more than once.
+func mergeEgressRules(defaults, app []models.SecurityGroupRule) []models.SecurityGroupRule {
+	if len(defaults) == 0 {
+		return app
+	}
+
+	merged := []models.SecurityGroupRule{}
+	seen := map[string]bool{}
+
+	for _, rules := range [][]models.SecurityGroupRule{defaults, app} {
+		for _, rule := range rules {
+			key := normalizedJSON(rule)
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			merged = append(merged, rule)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,128 @@
+package recipebuilder_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Egress Rules", func() {
+	dnsRule := models.SecurityGroupRule{
+		Protocol:     "udp",
+		Destinations: []string{"10.0.0.2"},
+		Ports:        []uint16{53},
+	}
+
+	metricsRule := models.SecurityGroupRule{
+		Protocol:     "tcp",
+		Destinations: []string{"10.0.16.0/24"},
+		PortRange:    &models.PortRange{Start: 9000, End: 9100},
+	}
+
+	Describe("LoadDefaultEgressRules", func() {
+		var path string
+
+		writeRules := func(contents string) {
+			err := ioutil.WriteFile(path, []byte(contents), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "egress-rules")
+			Ω(err).ShouldNot(HaveOccurred())
+			file.Close()
+
+			path = file.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("loads a list of rules", func() {
+			writeRules(`[
+				{"protocol": "udp", "destinations": ["10.0.0.2"], "ports": [53]},
+				{"protocol": "tcp", "destinations": ["10.0.16.0/24"], "port_range": {"start": 9000, "end": 9100}}
+			]`)
+
+			rules, err := recipebuilder.LoadDefaultEgressRules(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rules).Should(Equal([]models.SecurityGroupRule{dnsRule, metricsRule}))
+		})
+
+		It("rejects malformed json", func() {
+			writeRules(`[{"protocol"`)
+
+			_, err := recipebuilder.LoadDefaultEgressRules(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects invalid rules", func() {
+			writeRules(`[{"protocol": "bogus", "destinations": ["10.0.0.2"]}]`)
+
+			_, err := recipebuilder.LoadDefaultEgressRules(path)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("building an app", func() {
+		var (
+			config     recipebuilder.Config
+			desiredApp cc_messages.DesireAppRequestFromCC
+			rules      []models.SecurityGroupRule
+		)
+
+		BeforeEach(func() {
+			config = recipebuilder.Config{
+				Lifecycles:    map[string]string{"some-stack": "some-lifecycle.tgz"},
+				FileServerURL: "http://file-server.com",
+			}
+
+			desiredApp = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:  "the-app-guid",
+				DropletUri:   "http://the-droplet.uri.com",
+				Stack:        "some-stack",
+				NumInstances: 1,
+				EgressRules:  []models.SecurityGroupRule{metricsRule},
+			}
+		})
+
+		JustBeforeEach(func() {
+			desiredLRP, err := recipebuilder.New(config, lager.NewLogger("fakelogger")).Build(&desiredApp)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			rules = desiredLRP.EgressRules
+		})
+
+		It("uses the app's rules when there are no defaults", func() {
+			Ω(rules).Should(Equal([]models.SecurityGroupRule{metricsRule}))
+		})
+
+		Context("with default rules", func() {
+			BeforeEach(func() {
+				config.DefaultEgressRules = []models.SecurityGroupRule{dnsRule, metricsRule}
+			})
+
+			It("merges them with the app's rules without duplicates", func() {
+				Ω(rules).Should(Equal([]models.SecurityGroupRule{dnsRule, metricsRule}))
+			})
+
+			Context("when the app has no rules", func() {
+				BeforeEach(func() {
+					desiredApp.EgressRules = nil
+				})
+
+				It("still applies the defaults", func() {
+					Ω(rules).Should(Equal([]models.SecurityGroupRule{dnsRule, metricsRule}))
+				})
+			})
+		})
+	})
+})
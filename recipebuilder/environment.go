@@ -0,0 +1,118 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+)
+
+type EnvPrecedence string
+
+const (
+	// AppEnvPrecedence lets an app's own variables override the operator's.
+	AppEnvPrecedence EnvPrecedence = "app"
+	// PlatformEnvPrecedence lets the operator's variables override the app's.
+	PlatformEnvPrecedence EnvPrecedence = "platform"
+
+	DefaultEnvPrecedence = AppEnvPrecedence
+)
+
+// ReservedEnvNames are set by nsync itself; neither apps nor operators may
+// override them.
+var ReservedEnvNames = []string{"PORT", "MEMORY_LIMIT", "PROCESS_GUID"}
+
+func ParseEnvPrecedence(precedence string) (EnvPrecedence, error) {
+	switch EnvPrecedence(precedence) {
+	case AppEnvPrecedence, PlatformEnvPrecedence:
+		return EnvPrecedence(precedence), nil
+	}
+
+	return "", fmt.Errorf("unknown environment precedence %q; expected app or platform", precedence)
+}
+
+// LoadPlatformEnv reads the operator's variables from a JSON object of names
+// to values. The variables are sorted by name so every build of an app
+// produces the same recipe.
+func LoadPlatformEnv(path string) ([]models.EnvironmentVariable, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+	err = json.Unmarshal(contents, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if isReservedEnvName(name) {
+			return nil, fmt.Errorf("platform environment may not set reserved variable %q", name)
+		}
+
+		if !envVarNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("platform environment variable name %q is invalid", name)
+		}
+
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]models.EnvironmentVariable, len(names))
+	for i, name := range names {
+		env[i] = models.EnvironmentVariable{Name: name, Value: values[name]}
+	}
+
+	return env, nil
+}
+
+func (b *RecipeBuilder) lrpEnv(desiredApp *cc_messages.DesireAppRequestFromCC, port uint16, memoryMB int) []models.EnvironmentVariable {
+	appEnv := desiredApp.Environment.BBSEnvironment()
+
+	winners, losers := appEnv, b.platformEnv
+	if b.envPrecedence == PlatformEnvPrecedence {
+		winners, losers = b.platformEnv, appEnv
+	}
+
+	overridden := map[string]bool{}
+	for _, name := range ReservedEnvNames {
+		overridden[name] = true
+	}
+	for _, env := range winners {
+		overridden[env.Name] = true
+	}
+
+	env := []models.EnvironmentVariable{}
+	for _, loser := range losers {
+		if !overridden[loser.Name] {
+			env = append(env, loser)
+		}
+	}
+	for _, winner := range winners {
+		if !isReservedEnvName(winner.Name) {
+			env = append(env, winner)
+		}
+	}
+
+	return append(env,
+		models.EnvironmentVariable{Name: "PORT", Value: strconv.Itoa(int(port))},
+		models.EnvironmentVariable{Name: "MEMORY_LIMIT", Value: fmt.Sprintf("%dm", memoryMB)},
+		models.EnvironmentVariable{Name: "PROCESS_GUID", Value: desiredApp.ProcessGuid},
+	)
+}
+
+func isReservedEnvName(name string) bool {
+	for _, reserved := range ReservedEnvNames {
+		if name == reserved {
+			return true
+		}
+	}
+
+	return false
+}
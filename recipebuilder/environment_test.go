@@ -0,0 +1,153 @@
+package recipebuilder_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Environment", func() {
+	Describe("ParseEnvPrecedence", func() {
+		It("accepts app and platform", func() {
+			Ω(recipebuilder.ParseEnvPrecedence("app")).Should(Equal(recipebuilder.AppEnvPrecedence))
+			Ω(recipebuilder.ParseEnvPrecedence("platform")).Should(Equal(recipebuilder.PlatformEnvPrecedence))
+		})
+
+		It("rejects anything else", func() {
+			_, err := recipebuilder.ParseEnvPrecedence("operator")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("LoadPlatformEnv", func() {
+		var path string
+
+		writeEnv := func(contents string) {
+			err := ioutil.WriteFile(path, []byte(contents), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "platform-env")
+			Ω(err).ShouldNot(HaveOccurred())
+			file.Close()
+
+			path = file.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("loads the variables sorted by name", func() {
+			writeEnv(`{"ZONE": "z1", "CF_API": "https://api.example.com"}`)
+
+			env, err := recipebuilder.LoadPlatformEnv(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(env).Should(Equal([]models.EnvironmentVariable{
+				{Name: "CF_API", Value: "https://api.example.com"},
+				{Name: "ZONE", Value: "z1"},
+			}))
+		})
+
+		It("rejects malformed json", func() {
+			writeEnv(`{"ZONE"`)
+
+			_, err := recipebuilder.LoadPlatformEnv(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects reserved names", func() {
+			writeEnv(`{"PORT": "9090"}`)
+
+			_, err := recipebuilder.LoadPlatformEnv(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects invalid names", func() {
+			writeEnv(`{"1ZONE": "z1"}`)
+
+			_, err := recipebuilder.LoadPlatformEnv(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("errors when the file does not exist", func() {
+			_, err := recipebuilder.LoadPlatformEnv(path + "-missing")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("the LRP environment", func() {
+		var (
+			config     recipebuilder.Config
+			desiredApp cc_messages.DesireAppRequestFromCC
+			env        []models.EnvironmentVariable
+		)
+
+		BeforeEach(func() {
+			config = recipebuilder.Config{
+				Lifecycles:    map[string]string{"some-stack": "some-lifecycle.tgz"},
+				FileServerURL: "http://file-server.com",
+				PlatformEnv: []models.EnvironmentVariable{
+					{Name: "ZONE", Value: "platform-zone"},
+					{Name: "CF_API", Value: "https://api.example.com"},
+				},
+			}
+
+			desiredApp = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:  "the-app-guid",
+				DropletUri:   "http://the-droplet.uri.com",
+				Stack:        "some-stack",
+				MemoryMB:     256,
+				NumInstances: 1,
+				Environment: cc_messages.Environment{
+					{Name: "ZONE", Value: "app-zone"},
+					{Name: "PORT", Value: "1234"},
+					{Name: "MEMORY_LIMIT", Value: "9999m"},
+				},
+			}
+		})
+
+		JustBeforeEach(func() {
+			desiredLRP, err := recipebuilder.New(config, lager.NewLogger("fakelogger")).Build(&desiredApp)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			env = desiredLRP.Action.(*models.RunAction).Env
+		})
+
+		It("injects the platform variables", func() {
+			Ω(env).Should(ContainElement(models.EnvironmentVariable{Name: "CF_API", Value: "https://api.example.com"}))
+			Ω(env).Should(ContainElement(models.EnvironmentVariable{Name: "MEMORY_LIMIT", Value: "256m"}))
+			Ω(env).Should(ContainElement(models.EnvironmentVariable{Name: "PROCESS_GUID", Value: "the-app-guid"}))
+		})
+
+		It("does not let the app override reserved variables", func() {
+			Ω(env).Should(ContainElement(models.EnvironmentVariable{Name: "PORT", Value: "8080"}))
+			Ω(env).ShouldNot(ContainElement(models.EnvironmentVariable{Name: "PORT", Value: "1234"}))
+			Ω(env).ShouldNot(ContainElement(models.EnvironmentVariable{Name: "MEMORY_LIMIT", Value: "9999m"}))
+		})
+
+		It("lets the app override the operator by default", func() {
+			Ω(env).Should(ContainElement(models.EnvironmentVariable{Name: "ZONE", Value: "app-zone"}))
+			Ω(env).ShouldNot(ContainElement(models.EnvironmentVariable{Name: "ZONE", Value: "platform-zone"}))
+		})
+
+		Context("when the platform takes precedence", func() {
+			BeforeEach(func() {
+				config.EnvPrecedence = recipebuilder.PlatformEnvPrecedence
+			})
+
+			It("lets the operator override the app", func() {
+				Ω(env).Should(ContainElement(models.EnvironmentVariable{Name: "ZONE", Value: "platform-zone"}))
+				Ω(env).ShouldNot(ContainElement(models.EnvironmentVariable{Name: "ZONE", Value: "app-zone"}))
+			})
+		})
+	})
+})
@@ -0,0 +1,192 @@
+package recipebuilder
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+)
+
+const (
+	BuildpackLifecycleName = "buildpack"
+	DockerLifecycleName    = "docker"
+)
+
+var (
+	ErrNoLifecycleForApp  = errors.New("no enabled lifecycle handles the desired app")
+	ErrInvalidDropletHash = errors.New("droplet hash must be a hex-encoded sha1")
+
+	dropletHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+)
+
+// A Lifecycle knows how to run one kind of app: it decides whether it handles
+// a desired app and produces the parts of the recipe that depend on the kind
+// of app. The recipe builder fills in everything else, such as the
+// environment and resource limits of the action.
+type Lifecycle interface {
+	Name() string
+	Handles(desiredApp *cc_messages.DesireAppRequestFromCC) bool
+	Recipe(desiredApp *cc_messages.DesireAppRequestFromCC) (LifecycleRecipe, error)
+}
+
+type LifecycleRecipe struct {
+	Setup      []models.Action
+	Action     *models.RunAction
+	RootFSPath string
+	Privileged bool
+}
+
+// LifecycleEnabled reports whether a builder with the config runs apps of the
+// named lifecycle.
+func (c Config) LifecycleEnabled(name string) bool {
+	if c.EnabledLifecycles == nil {
+		return true
+	}
+
+	for _, enabled := range c.EnabledLifecycles {
+		if enabled == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseEnabledLifecycles parses a comma-separated list of lifecycle names.
+func ParseEnabledLifecycles(names string) ([]string, error) {
+	enabled := []string{}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		switch name {
+		case BuildpackLifecycleName, DockerLifecycleName:
+			enabled = append(enabled, name)
+		default:
+			return nil, fmt.Errorf("unknown lifecycle %q; expected buildpack or docker", name)
+		}
+	}
+
+	return enabled, nil
+}
+
+type buildpackLifecycle struct {
+	lifecycles    map[string]string
+	fileServerURL string
+}
+
+func NewBuildpackLifecycle(lifecycles map[string]string, fileServerURL string) Lifecycle {
+	return &buildpackLifecycle{
+		lifecycles:    lifecycles,
+		fileServerURL: fileServerURL,
+	}
+}
+
+func (l *buildpackLifecycle) Name() string {
+	return BuildpackLifecycleName
+}
+
+func (l *buildpackLifecycle) Handles(desiredApp *cc_messages.DesireAppRequestFromCC) bool {
+	return desiredApp.DropletUri != ""
+}
+
+func (l *buildpackLifecycle) Recipe(desiredApp *cc_messages.DesireAppRequestFromCC) (LifecycleRecipe, error) {
+	lifecyclePath, ok := l.lifecycles[desiredApp.Stack]
+	if !ok {
+		return LifecycleRecipe{}, ErrNoLifecycleDefined
+	}
+
+	setup := []models.Action{
+		&models.DownloadAction{
+			From: LifecycleDownloadURL(lifecyclePath, l.fileServerURL),
+			To:   "/tmp/lifecycle",
+		},
+	}
+
+	dropletCacheKey := fmt.Sprintf("droplets-%s", desiredApp.ProcessGuid)
+	if desiredApp.DropletHash != "" {
+		if !dropletHashPattern.MatchString(desiredApp.DropletHash) {
+			return LifecycleRecipe{}, ErrInvalidDropletHash
+		}
+
+		// keying the cache by content means a cell only ever reuses a droplet
+		// it downloaded for this very checksum, and keeps reusing it across
+		// restarts and instances of the same droplet
+		dropletCacheKey = fmt.Sprintf("droplets-sha1-%s", strings.ToLower(desiredApp.DropletHash))
+	}
+
+	setup = append(setup, &models.DownloadAction{
+		From:     desiredApp.DropletUri,
+		To:       ".",
+		CacheKey: dropletCacheKey,
+	})
+
+	return LifecycleRecipe{
+		Setup:      setup,
+		Action:     launcherAction(desiredApp),
+		Privileged: true,
+	}, nil
+}
+
+type dockerLifecycle struct {
+	dockerLifecyclePath string
+	fileServerURL       string
+	registryRules       DockerRegistryRules
+}
+
+func NewDockerLifecycle(dockerLifecyclePath, fileServerURL string, registryRules DockerRegistryRules) Lifecycle {
+	return &dockerLifecycle{
+		dockerLifecyclePath: dockerLifecyclePath,
+		fileServerURL:       fileServerURL,
+		registryRules:       registryRules,
+	}
+}
+
+func (l *dockerLifecycle) Name() string {
+	return DockerLifecycleName
+}
+
+func (l *dockerLifecycle) Handles(desiredApp *cc_messages.DesireAppRequestFromCC) bool {
+	return desiredApp.DockerImageUrl != ""
+}
+
+func (l *dockerLifecycle) Recipe(desiredApp *cc_messages.DesireAppRequestFromCC) (LifecycleRecipe, error) {
+	reference, err := ParseDockerReference(desiredApp.DockerImageUrl)
+	if err != nil {
+		return LifecycleRecipe{}, err
+	}
+
+	reference, err = l.registryRules.Rewrite(reference)
+	if err != nil {
+		return LifecycleRecipe{}, err
+	}
+
+	return LifecycleRecipe{
+		Setup: []models.Action{
+			&models.DownloadAction{
+				From: LifecycleDownloadURL(l.dockerLifecyclePath, l.fileServerURL),
+				To:   "/tmp/lifecycle",
+			},
+		},
+		Action:     launcherAction(desiredApp),
+		RootFSPath: reference.RootFSPath(),
+		Privileged: false,
+	}, nil
+}
+
+func launcherAction(desiredApp *cc_messages.DesireAppRequestFromCC) *models.RunAction {
+	return &models.RunAction{
+		Path: "/tmp/lifecycle/launcher",
+		Args: append(
+			[]string{"/app"},
+			desiredApp.StartCommand,
+			desiredApp.ExecutionMetadata,
+		),
+	}
+}
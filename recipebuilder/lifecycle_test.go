@@ -0,0 +1,157 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lifecycles", func() {
+	var desiredApp cc_messages.DesireAppRequestFromCC
+
+	BeforeEach(func() {
+		desiredApp = cc_messages.DesireAppRequestFromCC{
+			ProcessGuid:       "the-app-guid",
+			Stack:             "some-stack",
+			StartCommand:      "the-start-command",
+			ExecutionMetadata: "the-execution-metadata",
+		}
+	})
+
+	Describe("ParseEnabledLifecycles", func() {
+		It("parses a comma-separated list", func() {
+			enabled, err := recipebuilder.ParseEnabledLifecycles("buildpack, docker")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(enabled).Should(Equal([]string{"buildpack", "docker"}))
+		})
+
+		It("allows disabling every lifecycle", func() {
+			enabled, err := recipebuilder.ParseEnabledLifecycles("")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(enabled).Should(BeEmpty())
+		})
+
+		It("rejects unknown lifecycles", func() {
+			_, err := recipebuilder.ParseEnabledLifecycles("buildpack,windows")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("the buildpack lifecycle", func() {
+		var lifecycle recipebuilder.Lifecycle
+
+		BeforeEach(func() {
+			lifecycle = recipebuilder.NewBuildpackLifecycle(map[string]string{
+				"some-stack": "some-lifecycle.tgz",
+			}, "http://file-server.com")
+
+			desiredApp.DropletUri = "http://the-droplet.uri.com"
+		})
+
+		It("handles apps with a droplet", func() {
+			Ω(lifecycle.Handles(&desiredApp)).Should(BeTrue())
+
+			desiredApp.DropletUri = ""
+			Ω(lifecycle.Handles(&desiredApp)).Should(BeFalse())
+		})
+
+		It("downloads the stack's lifecycle and the droplet into a privileged container", func() {
+			recipe, err := lifecycle.Recipe(&desiredApp)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(recipe.Setup).Should(Equal([]models.Action{
+				&models.DownloadAction{
+					From: "http://file-server.com/v1/static/some-lifecycle.tgz",
+					To:   "/tmp/lifecycle",
+				},
+				&models.DownloadAction{
+					From:     "http://the-droplet.uri.com",
+					To:       ".",
+					CacheKey: "droplets-the-app-guid",
+				},
+			}))
+			Ω(recipe.Action).Should(Equal(&models.RunAction{
+				Path: "/tmp/lifecycle/launcher",
+				Args: []string{"/app", "the-start-command", "the-execution-metadata"},
+			}))
+			Ω(recipe.RootFSPath).Should(BeEmpty())
+			Ω(recipe.Privileged).Should(BeTrue())
+		})
+
+		Context("when the desire message carries a droplet checksum", func() {
+			const dropletHash = "0123456789ABCDEF0123456789abcdef01234567"
+
+			BeforeEach(func() {
+				desiredApp.DropletHash = dropletHash
+			})
+
+			It("caches the droplet by its checksum", func() {
+				recipe, err := lifecycle.Recipe(&desiredApp)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(recipe.Setup).Should(HaveLen(2))
+				Ω(recipe.Setup[1]).Should(Equal(&models.DownloadAction{
+					From:     "http://the-droplet.uri.com",
+					To:       ".",
+					CacheKey: "droplets-sha1-0123456789abcdef0123456789abcdef01234567",
+				}))
+			})
+
+			Context("when the checksum is malformed", func() {
+				BeforeEach(func() {
+					desiredApp.DropletHash = "not-a-sha1"
+				})
+
+				It("errors", func() {
+					_, err := lifecycle.Recipe(&desiredApp)
+					Ω(err).Should(MatchError(recipebuilder.ErrInvalidDropletHash))
+				})
+			})
+		})
+
+		Context("when the stack has no lifecycle", func() {
+			BeforeEach(func() {
+				desiredApp.Stack = "some-other-stack"
+			})
+
+			It("errors", func() {
+				_, err := lifecycle.Recipe(&desiredApp)
+				Ω(err).Should(MatchError(recipebuilder.ErrNoLifecycleDefined))
+			})
+		})
+	})
+
+	Describe("the docker lifecycle", func() {
+		var lifecycle recipebuilder.Lifecycle
+
+		BeforeEach(func() {
+			lifecycle = recipebuilder.NewDockerLifecycle("the/docker/lifecycle/path.tgz", "http://file-server.com", nil)
+
+			desiredApp.DockerImageUrl = "user/repo:tag"
+		})
+
+		It("handles apps with a docker image", func() {
+			Ω(lifecycle.Handles(&desiredApp)).Should(BeTrue())
+
+			desiredApp.DockerImageUrl = ""
+			Ω(lifecycle.Handles(&desiredApp)).Should(BeFalse())
+		})
+
+		It("downloads the docker lifecycle and runs the image in an unprivileged container", func() {
+			recipe, err := lifecycle.Recipe(&desiredApp)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(recipe.Setup).Should(Equal([]models.Action{
+				&models.DownloadAction{
+					From: "http://file-server.com/v1/static/the/docker/lifecycle/path.tgz",
+					To:   "/tmp/lifecycle",
+				},
+			}))
+			Ω(recipe.RootFSPath).Should(Equal("docker:///user/repo#tag"))
+			Ω(recipe.Privileged).Should(BeFalse())
+		})
+	})
+})
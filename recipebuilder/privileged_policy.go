@@ -0,0 +1,71 @@
+package recipebuilder
+
+import "fmt"
+
+type PrivilegedMode string
+
+const (
+	// UnprivilegedMode runs every app unprivileged unless it is allowlisted.
+	UnprivilegedMode PrivilegedMode = "unprivileged"
+	// LifecyclePrivilegedMode lets the lifecycle, or the stack profile,
+	// decide for every app.
+	LifecyclePrivilegedMode PrivilegedMode = "lifecycle"
+
+	DefaultPrivilegedMode = UnprivilegedMode
+)
+
+func ParsePrivilegedMode(mode string) (PrivilegedMode, error) {
+	switch PrivilegedMode(mode) {
+	case UnprivilegedMode, LifecyclePrivilegedMode:
+		return PrivilegedMode(mode), nil
+	}
+
+	return "", fmt.Errorf("unknown privileged mode %q; expected unprivileged or lifecycle", mode)
+}
+
+// A PrivilegedPolicy decides whether an app that wants a privileged container
+// gets one. It never makes an app privileged that did not ask to be.
+type PrivilegedPolicy struct {
+	Mode PrivilegedMode
+
+	// Stacks and ProcessGuids may run privileged whatever the mode.
+	Stacks       []string
+	ProcessGuids []string
+}
+
+// PrivilegedDecision records why an app did or did not get a privileged
+// container.
+type PrivilegedDecision struct {
+	Requested  bool   `json:"requested"`
+	Privileged bool   `json:"privileged"`
+	Reason     string `json:"reason"`
+}
+
+func (p PrivilegedPolicy) Decide(processGuid, stack string, requested bool) PrivilegedDecision {
+	decide := func(privileged bool, reason string) PrivilegedDecision {
+		return PrivilegedDecision{Requested: requested, Privileged: privileged, Reason: reason}
+	}
+
+	switch {
+	case !requested:
+		return decide(false, "not-requested")
+	case contains(p.ProcessGuids, processGuid):
+		return decide(true, "process-guid-allowed")
+	case contains(p.Stacks, stack):
+		return decide(true, "stack-allowed")
+	case p.Mode == LifecyclePrivilegedMode:
+		return decide(true, "lifecycle-mode")
+	default:
+		return decide(false, "denied-by-policy")
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Privileged Policy", func() {
+	Describe("ParsePrivilegedMode", func() {
+		It("accepts unprivileged and lifecycle", func() {
+			Ω(recipebuilder.ParsePrivilegedMode("unprivileged")).Should(Equal(recipebuilder.UnprivilegedMode))
+			Ω(recipebuilder.ParsePrivilegedMode("lifecycle")).Should(Equal(recipebuilder.LifecyclePrivilegedMode))
+		})
+
+		It("rejects anything else", func() {
+			_, err := recipebuilder.ParsePrivilegedMode("always")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Decide", func() {
+		var policy recipebuilder.PrivilegedPolicy
+
+		BeforeEach(func() {
+			policy = recipebuilder.PrivilegedPolicy{
+				Mode:         recipebuilder.UnprivilegedMode,
+				Stacks:       []string{"trusted-stack"},
+				ProcessGuids: []string{"trusted-guid"},
+			}
+		})
+
+		It("never grants privileges that were not requested", func() {
+			decision := policy.Decide("trusted-guid", "trusted-stack", false)
+			Ω(decision.Privileged).Should(BeFalse())
+			Ω(decision.Reason).Should(Equal("not-requested"))
+		})
+
+		It("denies apps that are not allowlisted", func() {
+			decision := policy.Decide("some-guid", "some-stack", true)
+			Ω(decision.Privileged).Should(BeFalse())
+			Ω(decision.Reason).Should(Equal("denied-by-policy"))
+		})
+
+		It("allows allowlisted process guids", func() {
+			decision := policy.Decide("trusted-guid", "some-stack", true)
+			Ω(decision.Privileged).Should(BeTrue())
+			Ω(decision.Reason).Should(Equal("process-guid-allowed"))
+		})
+
+		It("allows allowlisted stacks", func() {
+			decision := policy.Decide("some-guid", "trusted-stack", true)
+			Ω(decision.Privileged).Should(BeTrue())
+			Ω(decision.Reason).Should(Equal("stack-allowed"))
+		})
+
+		Context("in lifecycle mode", func() {
+			BeforeEach(func() {
+				policy.Mode = recipebuilder.LifecyclePrivilegedMode
+			})
+
+			It("allows every request", func() {
+				decision := policy.Decide("some-guid", "some-stack", true)
+				Ω(decision.Privileged).Should(BeTrue())
+				Ω(decision.Reason).Should(Equal("lifecycle-mode"))
+			})
+		})
+	})
+
+	Describe("building a buildpack app", func() {
+		var (
+			logger     *lagertest.TestLogger
+			config     recipebuilder.Config
+			desiredApp cc_messages.DesireAppRequestFromCC
+			privileged bool
+		)
+
+		BeforeEach(func() {
+			logger = lagertest.NewTestLogger("test")
+
+			config = recipebuilder.Config{
+				Lifecycles:    map[string]string{"some-stack": "some-lifecycle.tgz"},
+				FileServerURL: "http://file-server.com",
+			}
+
+			desiredApp = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:  "the-app-guid",
+				DropletUri:   "http://the-droplet.uri.com",
+				Stack:        "some-stack",
+				NumInstances: 1,
+			}
+		})
+
+		JustBeforeEach(func() {
+			desiredLRP, err := recipebuilder.New(config, logger).Build(&desiredApp)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			privileged = desiredLRP.Privileged
+		})
+
+		It("runs it unprivileged by default", func() {
+			Ω(privileged).Should(BeFalse())
+		})
+
+		It("logs the decision", func() {
+			Ω(logger).Should(gbytes.Say("privileged-decision"))
+			Ω(logger).Should(gbytes.Say("denied-by-policy"))
+		})
+
+		Context("when its stack is allowlisted", func() {
+			BeforeEach(func() {
+				config.PrivilegedPolicy.Stacks = []string{"some-stack"}
+			})
+
+			It("runs it privileged", func() {
+				Ω(privileged).Should(BeTrue())
+			})
+		})
+	})
+})
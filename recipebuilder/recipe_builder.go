@@ -3,16 +3,15 @@ package recipebuilder
 import (
 	"errors"
 	"fmt"
-	"net/url"
 	"strings"
 	"time"
 
 	"github.com/cloudfoundry-incubator/receptor"
-	"github.com/cloudfoundry-incubator/route-emitter/cfroutes"
 	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
 	"github.com/cloudfoundry-incubator/runtime-schema/models"
 	"github.com/cloudfoundry-incubator/runtime-schema/routes"
 	"github.com/cloudfoundry/gunk/urljoiner"
+	"github.com/pivotal-golang/clock"
 	"github.com/pivotal-golang/lager"
 )
 
@@ -31,27 +30,187 @@ const (
 
 	Router      = "router"
 	DefaultPort = uint16(8080)
+
+	ProcessHealthCheckType = cc_messages.HealthCheckType("process")
+	HTTPHealthCheckType    = cc_messages.HealthCheckType("http")
+
+	DefaultHealthCheckTimeout      = 30 * time.Second
+	DefaultHealthCheckProbeTimeout = time.Second
+	DefaultHealthCheckInterval     = time.Second
 )
 
 var (
-	ErrNoLifecycleDefined = errors.New("no lifecycle binary bundle defined for stack")
-	ErrAppSourceMissing   = errors.New("desired app missing both droplet_uri and docker_image; exactly one is required.")
-	ErrMultipleAppSources = errors.New("desired app contains both droplet_uri and docker_image; exactly one is required.")
+	ErrNoLifecycleDefined         = errors.New("no lifecycle binary bundle defined for stack")
+	ErrAppSourceMissing           = errors.New("desired app missing both droplet_uri and docker_image; exactly one is required.")
+	ErrMultipleAppSources         = errors.New("desired app contains both droplet_uri and docker_image; exactly one is required.")
+	ErrInvalidHealthCheckEndpoint = errors.New("http health check requires an endpoint path starting with '/'")
 )
 
+type UnsupportedHealthCheckTypeError struct {
+	HealthCheckType cc_messages.HealthCheckType
+}
+
+func (e UnsupportedHealthCheckTypeError) Error() string {
+	return fmt.Sprintf("unsupported health check type: %q", string(e.HealthCheckType))
+}
+
+type Config struct {
+	Lifecycles          map[string]string
+	DockerLifecyclePath string
+	FileServerURL       string
+
+	// HealthCheckTimeout bounds a single run of the health check monitor.
+	HealthCheckTimeout time.Duration
+	// HealthCheckProbeTimeout bounds each request made by the http health check.
+	HealthCheckProbeTimeout time.Duration
+	// HealthCheckInterval is the wait between requests of the http health check.
+	HealthCheckInterval time.Duration
+
+	// DockerPortRule chooses among the ports a docker image exposes.
+	DockerPortRule DockerPortRule
+	// DockerRegistryRules mirror or deny docker images by registry.
+	DockerRegistryRules DockerRegistryRules
+
+	// EnabledLifecycles names the lifecycles the builder may use; all of
+	// them are enabled when it is nil.
+	EnabledLifecycles []string
+
+	// ResourcePolicy decides the memory, disk, instances and CPU weight an
+	// app may have.
+	ResourcePolicy ResourcePolicy
+
+	// PlatformEnv is injected into every LRP alongside the app's own env.
+	PlatformEnv []models.EnvironmentVariable
+	// EnvPrecedence decides whether app or platform variables win when both
+	// set the same name.
+	EnvPrecedence EnvPrecedence
+
+	// StackProfiles customize the recipes of apps by stack.
+	StackProfiles StackProfiles
+
+	// PrivilegedPolicy decides which apps may run in privileged containers;
+	// its zero value runs every app unprivileged.
+	PrivilegedPolicy PrivilegedPolicy
+
+	// DefaultEgressRules are added to the egress rules of every app.
+	DefaultEgressRules []models.SecurityGroupRule
+
+	// SSH runs an SSH daemon next to apps that allow it.
+	SSH SSHConfig
+
+	// StackAliases move apps off retired stacks.
+	StackAliases StackAliases
+
+	// Clock decides when stack aliases reach their cutoff; it defaults to
+	// the real clock.
+	Clock clock.Clock
+}
+
 type RecipeBuilder struct {
-	logger              lager.Logger
-	lifecycles          map[string]string
-	dockerLifecyclePath string
-	fileServerURL       string
+	logger     lager.Logger
+	lifecycles []Lifecycle
+
+	healthCheckTimeout      time.Duration
+	healthCheckProbeTimeout time.Duration
+	healthCheckInterval     time.Duration
+
+	dockerPortRule DockerPortRule
+
+	resourcePolicy ResourcePolicy
+
+	platformEnv   []models.EnvironmentVariable
+	envPrecedence EnvPrecedence
+
+	stackProfiles StackProfiles
+
+	privilegedPolicy PrivilegedPolicy
+
+	defaultEgressRules []models.SecurityGroupRule
+
+	sshDaemon *sshDaemon
+
+	stackAliases StackAliases
+
+	clock clock.Clock
 }
 
-func New(lifecycles map[string]string, dockerLifecyclePath, fileServerURL string, logger lager.Logger) *RecipeBuilder {
+func New(config Config, logger lager.Logger) *RecipeBuilder {
+	healthCheckTimeout := config.HealthCheckTimeout
+	if healthCheckTimeout == 0 {
+		healthCheckTimeout = DefaultHealthCheckTimeout
+	}
+
+	healthCheckProbeTimeout := config.HealthCheckProbeTimeout
+	if healthCheckProbeTimeout == 0 {
+		healthCheckProbeTimeout = DefaultHealthCheckProbeTimeout
+	}
+
+	healthCheckInterval := config.HealthCheckInterval
+	if healthCheckInterval == 0 {
+		healthCheckInterval = DefaultHealthCheckInterval
+	}
+
+	dockerPortRule := config.DockerPortRule
+	if dockerPortRule == "" {
+		dockerPortRule = DefaultDockerPortRule
+	}
+
+	envPrecedence := config.EnvPrecedence
+	if envPrecedence == "" {
+		envPrecedence = DefaultEnvPrecedence
+	}
+
+	privilegedPolicy := config.PrivilegedPolicy
+	if privilegedPolicy.Mode == "" {
+		privilegedPolicy.Mode = DefaultPrivilegedMode
+	}
+
+	builderClock := config.Clock
+	if builderClock == nil {
+		builderClock = clock.NewClock()
+	}
+
+	enabledLifecycles := config.EnabledLifecycles
+	if enabledLifecycles == nil {
+		enabledLifecycles = []string{BuildpackLifecycleName, DockerLifecycleName}
+	}
+
+	lifecycles := []Lifecycle{}
+	for _, name := range enabledLifecycles {
+		switch name {
+		case BuildpackLifecycleName:
+			lifecycles = append(lifecycles, NewBuildpackLifecycle(config.StackAliases.Lifecycles(config.Lifecycles), config.FileServerURL))
+		case DockerLifecycleName:
+			lifecycles = append(lifecycles, NewDockerLifecycle(config.DockerLifecyclePath, config.FileServerURL, config.DockerRegistryRules))
+		}
+	}
+
 	return &RecipeBuilder{
-		lifecycles:          lifecycles,
-		logger:              logger,
-		dockerLifecyclePath: dockerLifecyclePath,
-		fileServerURL:       fileServerURL,
+		logger:     logger,
+		lifecycles: lifecycles,
+
+		healthCheckTimeout:      healthCheckTimeout,
+		healthCheckProbeTimeout: healthCheckProbeTimeout,
+		healthCheckInterval:     healthCheckInterval,
+
+		dockerPortRule: dockerPortRule,
+
+		resourcePolicy: config.ResourcePolicy,
+
+		platformEnv:   config.PlatformEnv,
+		envPrecedence: envPrecedence,
+
+		stackProfiles: config.StackProfiles,
+
+		privilegedPolicy: privilegedPolicy,
+
+		defaultEgressRules: config.DefaultEgressRules,
+
+		sshDaemon: newSSHDaemon(config.SSH, config.FileServerURL),
+
+		stackAliases: config.StackAliases,
+
+		clock: builderClock,
 	}
 }
 
@@ -70,111 +229,141 @@ func (b *RecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestFromCC) (*
 		return nil, ErrMultipleAppSources
 	}
 
-	rootFSPath := ""
-	lifecycleURL := ""
-
-	if desiredApp.DockerImageUrl != "" {
-		lifecycleURL = b.lifecycleDownloadURL(b.dockerLifecyclePath, b.fileServerURL)
-
-		rootFSPath = convertDockerURI(desiredApp.DockerImageUrl)
-	} else {
-		lifecyclePath, ok := b.lifecycles[desiredApp.Stack]
-		if !ok {
-			buildLogger.Error("unknown-stack", ErrNoLifecycleDefined, lager.Data{
-				"stack": desiredApp.Stack,
-			})
+	stack, err := b.resolveStack(buildLogger, lrpGuid, desiredApp.Stack)
+	if err != nil {
+		return nil, err
+	}
 
-			return nil, ErrNoLifecycleDefined
-		}
+	lifecycle, ok := b.lifecycleFor(desiredApp)
+	if !ok {
+		buildLogger.Error("no-lifecycle", ErrNoLifecycleForApp, lager.Data{"desired-app": desiredApp})
+		return nil, ErrNoLifecycleForApp
+	}
 
-		lifecycleURL = b.lifecycleDownloadURL(lifecyclePath, b.fileServerURL)
+	recipe, err := lifecycle.Recipe(desiredApp)
+	if err != nil {
+		buildLogger.Error("failed-to-build-lifecycle-recipe", err, lager.Data{
+			"lifecycle": lifecycle.Name(),
+			"stack":     desiredApp.Stack,
+		})
+		return nil, err
 	}
 
-	privilegedContainer := false
+	ports, err := b.Ports(desiredApp)
+	if err != nil {
+		buildLogger.Error("invalid-ports", err, lager.Data{
+			"ports":              desiredApp.Ports,
+			"execution-metadata": desiredApp.ExecutionMetadata,
+		})
+		return nil, err
+	}
 
-	if desiredApp.DockerImageUrl == "" {
-		privilegedContainer = true
+	routingInfo, err := b.RoutingInfo(desiredApp)
+	if err != nil {
+		buildLogger.Error("invalid-routes", err, lager.Data{"port-routes": desiredApp.PortRoutes})
+		return nil, err
 	}
 
-	numFiles := DefaultFileDescriptorLimit
-	if desiredApp.FileDescriptors != 0 {
-		numFiles = desiredApp.FileDescriptors
+	healthCheckPort, err := b.HealthCheckPort(desiredApp)
+	if err != nil {
+		buildLogger.Error("invalid-health-check-port", err, lager.Data{"health-check-port": desiredApp.HealthCheckPort})
+		return nil, err
 	}
 
-	var setup []models.Action
-	var action, monitor models.Action
+	profile := b.stackProfiles[stack]
 
-	setup = append(setup, &models.DownloadAction{
-		From: lifecycleURL,
-		To:   "/tmp/lifecycle",
+	numFiles := profile.fileDescriptorLimit(desiredApp.FileDescriptors)
+	memoryMB := b.resourcePolicy.memoryMB(profile.memoryMB(desiredApp.MemoryMB))
+	diskMB := b.resourcePolicy.diskMB(profile.diskMB(desiredApp.DiskMB))
+
+	privileged := b.privilegedPolicy.Decide(lrpGuid, stack, profile.privileged(recipe.Privileged))
+	buildLogger.Info("privileged-decision", lager.Data{
+		"process-guid": lrpGuid,
+		"stack":        stack,
+		"decision":     privileged,
 	})
 
+	var monitor models.Action
+
 	switch desiredApp.HealthCheckType {
 	case cc_messages.PortHealthCheckType, cc_messages.UnspecifiedHealthCheckType:
-		fileDescriptorLimit := DefaultFileDescriptorLimit
-		monitor = &models.TimeoutAction{
-			Timeout: 30 * time.Second,
-			Action: &models.RunAction{
-				Path:      "/tmp/lifecycle/healthcheck",
-				Args:      []string{"-port=8080"},
-				LogSource: HealthLogSource,
-				ResourceLimits: models.ResourceLimits{
-					Nofile: &fileDescriptorLimit,
-				},
-			},
+		monitor = b.healthCheckMonitor([]string{portFlag(healthCheckPort)})
+
+	case HTTPHealthCheckType:
+		endpoint := desiredApp.HealthCheckHTTPEndpoint
+		if !strings.HasPrefix(endpoint, "/") {
+			buildLogger.Error("invalid-health-check-endpoint", ErrInvalidHealthCheckEndpoint, lager.Data{
+				"endpoint": endpoint,
+			})
+			return nil, ErrInvalidHealthCheckEndpoint
 		}
-	}
 
-	if desiredApp.DropletUri != "" {
-		setup = append(setup, &models.DownloadAction{
-			From:     desiredApp.DropletUri,
-			To:       ".",
-			CacheKey: fmt.Sprintf("droplets-%s", lrpGuid),
+		monitor = b.healthCheckMonitor([]string{
+			portFlag(healthCheckPort),
+			"-uri=" + endpoint,
+			"-timeout=" + b.probeTimeout(desiredApp).String(),
+			"-interval=" + b.probeInterval(desiredApp).String(),
 		})
+
+	case cc_messages.NoneHealthCheckType:
+		// no monitor
+
+	case ProcessHealthCheckType:
+		// the executor marks the instance as crashed as soon as the launcher
+		// exits, so tracking the process needs no separate monitor action
+
+	default:
+		err = UnsupportedHealthCheckTypeError{HealthCheckType: desiredApp.HealthCheckType}
+		buildLogger.Error("unsupported-health-check-type", err, lager.Data{
+			"health-check-type": desiredApp.HealthCheckType,
+		})
+		return nil, err
 	}
 
-	action = &models.RunAction{
-		Path: "/tmp/lifecycle/launcher",
-		Args: append(
-			[]string{"/app"},
-			desiredApp.StartCommand,
-			desiredApp.ExecutionMetadata,
-		),
-		Env:       createLrpEnv(desiredApp.Environment.BBSEnvironment()),
-		LogSource: AppLogSource,
-		ResourceLimits: models.ResourceLimits{
-			Nofile: &numFiles,
-		},
+	action := recipe.Action
+	action.Env = b.lrpEnv(desiredApp, ports[0], memoryMB)
+	action.LogSource = AppLogSource
+	action.ResourceLimits = models.ResourceLimits{
+		Nofile: &numFiles,
 	}
 
-	setupAction := models.Serial(setup...)
+	setup := append(recipe.Setup, profile.setup()...)
+	var lrpAction models.Action = action
+	lrpPorts := ports
 
-	desiredAppRoutingInfo := cfroutes.CFRoutes{
-		{Hostnames: desiredApp.Routes, Port: DefaultPort},
-	}.RoutingInfo()
+	if b.sshDaemon.handles(desiredApp) {
+		lrpPorts, err = b.sshDaemon.ports(ports)
+		if err != nil {
+			buildLogger.Error("invalid-ssh-port", err, lager.Data{"ports": ports})
+			return nil, err
+		}
 
-	return &receptor.DesiredLRPCreateRequest{
-		Privileged: privilegedContainer,
+		setup = append(setup, b.sshDaemon.setup())
+		lrpAction = models.Codependent(action, b.sshDaemon.action(numFiles))
+	}
+
+	setupAction := models.Serial(setup...)
+
+	desiredLRP := &receptor.DesiredLRPCreateRequest{
+		Privileged: privileged.Privileged,
 
 		Domain: LRPDomain,
 
 		ProcessGuid: lrpGuid,
 		Instances:   desiredApp.NumInstances,
-		Routes:      desiredAppRoutingInfo,
-		Annotation:  desiredApp.ETag,
+		Routes:      routingInfo,
+		Annotation:  NewAnnotation(desiredApp.ETag).String(),
 
-		CPUWeight: cpuWeight(desiredApp.MemoryMB),
+		CPUWeight: b.resourcePolicy.cpuWeight(memoryMB),
 
-		MemoryMB: desiredApp.MemoryMB,
-		DiskMB:   desiredApp.DiskMB,
+		MemoryMB: memoryMB,
+		DiskMB:   diskMB,
 
-		Ports: []uint16{
-			DefaultPort,
-		},
+		Ports: lrpPorts,
 
-		RootFSPath: rootFSPath,
+		RootFSPath: recipe.RootFSPath,
 
-		Stack: desiredApp.Stack,
+		Stack: stack,
 
 		LogGuid:   desiredApp.LogGuid,
 		LogSource: LRPLogSource,
@@ -182,63 +371,118 @@ func (b *RecipeBuilder) Build(desiredApp *cc_messages.DesireAppRequestFromCC) (*
 		MetricsGuid: desiredApp.LogGuid,
 
 		Setup:   setupAction,
-		Action:  action,
+		Action:  lrpAction,
 		Monitor: monitor,
 
 		StartTimeout: desiredApp.HealthCheckTimeoutInSeconds,
 
-		EgressRules: desiredApp.EgressRules,
-	}, nil
-}
+		EgressRules: mergeEgressRules(b.defaultEgressRules, desiredApp.EgressRules),
+	}
 
-func (b RecipeBuilder) lifecycleDownloadURL(lifecyclePath string, fileServerURL string) string {
-	staticPath, err := routes.FileServerRoutes.CreatePathForRoute(routes.FS_STATIC, nil)
+	err = b.validate(desiredLRP)
 	if err != nil {
-		panic("couldn't generate the download path for the bundle of app lifecycle binaries: " + err.Error())
+		buildLogger.Error("invalid-desired-lrp", err, lager.Data{
+			"process-guid":      lrpGuid,
+			"validation-errors": err.(ValidationError).Messages(),
+		})
+		return nil, err
 	}
 
-	return urljoiner.Join(fileServerURL, staticPath, lifecyclePath)
+	return desiredLRP, nil
 }
 
-func createLrpEnv(env []models.EnvironmentVariable) []models.EnvironmentVariable {
-	env = append(env, models.EnvironmentVariable{Name: "PORT", Value: "8080"})
-	return env
-}
+// BuildUpdate builds the in-place update for an app whose LRP already exists.
+func (b *RecipeBuilder) BuildUpdate(desiredApp *cc_messages.DesireAppRequestFromCC) (*receptor.DesiredLRPUpdateRequest, error) {
+	routingInfo, err := b.RoutingInfo(desiredApp)
+	if err != nil {
+		b.logger.Session("update-builder").Error("invalid-routes", err, lager.Data{
+			"process-guid": desiredApp.ProcessGuid,
+		})
+		return nil, err
+	}
 
-func convertDockerURI(dockerURI string) string {
-	repo, tag := parseDockerRepositoryTag(dockerURI)
+	var validationErr ValidationError
+	if err := b.resourcePolicy.instancesError(desiredApp.NumInstances); err != nil {
+		validationErr = append(validationErr, err)
+	}
+	validationErr = append(validationErr, routeErrors(routingInfo)...)
+
+	if len(validationErr) > 0 {
+		b.logger.Session("update-builder").Error("invalid-update", validationErr, lager.Data{
+			"process-guid":      desiredApp.ProcessGuid,
+			"validation-errors": validationErr.Messages(),
+		})
+		return nil, validationErr
+	}
 
-	return (&url.URL{
-		Scheme:   DockerScheme,
-		Path:     "/" + repo,
-		Fragment: tag,
-	}).String()
+	annotation := NewAnnotation(desiredApp.ETag).String()
+
+	return &receptor.DesiredLRPUpdateRequest{
+		Annotation: &annotation,
+		Instances:  &desiredApp.NumInstances,
+		Routes:     routingInfo,
+	}, nil
 }
 
-// via https://github.com/docker/docker/blob/4398108/pkg/parsers/parsers.go#L72
-func parseDockerRepositoryTag(repos string) (string, string) {
-	n := strings.LastIndex(repos, ":")
-	if n < 0 {
-		return repos, ""
+func (b RecipeBuilder) healthCheckMonitor(args []string) models.Action {
+	fileDescriptorLimit := DefaultFileDescriptorLimit
+
+	return &models.TimeoutAction{
+		Timeout: b.healthCheckTimeout,
+		Action: &models.RunAction{
+			Path:      "/tmp/lifecycle/healthcheck",
+			Args:      args,
+			LogSource: HealthLogSource,
+			ResourceLimits: models.ResourceLimits{
+				Nofile: &fileDescriptorLimit,
+			},
+		},
+	}
+}
+
+// probeTimeout prefers the app's own probe timeout over the builder's, and
+// never lets a single probe outlive the monitor run it belongs to.
+func (b RecipeBuilder) probeTimeout(desiredApp *cc_messages.DesireAppRequestFromCC) time.Duration {
+	timeout := b.healthCheckProbeTimeout
+	if desiredApp.HealthCheckProbeTimeoutInSeconds > 0 {
+		timeout = time.Duration(desiredApp.HealthCheckProbeTimeoutInSeconds) * time.Second
 	}
 
-	if tag := repos[n+1:]; !strings.Contains(tag, "/") {
-		return repos[:n], tag
+	if timeout > b.healthCheckTimeout {
+		return b.healthCheckTimeout
 	}
 
-	return repos, ""
+	return timeout
 }
 
-func cpuWeight(memoryMB int) uint {
-	cpuProxy := memoryMB
+func (b RecipeBuilder) probeInterval(desiredApp *cc_messages.DesireAppRequestFromCC) time.Duration {
+	if desiredApp.HealthCheckIntervalInSeconds > 0 {
+		return time.Duration(desiredApp.HealthCheckIntervalInSeconds) * time.Second
+	}
+
+	return b.healthCheckInterval
+}
 
-	if cpuProxy > MaxCpuProxy {
-		return 100
+func (b *RecipeBuilder) lifecycleFor(desiredApp *cc_messages.DesireAppRequestFromCC) (Lifecycle, bool) {
+	for _, lifecycle := range b.lifecycles {
+		if lifecycle.Handles(desiredApp) {
+			return lifecycle, true
+		}
 	}
 
-	if cpuProxy < MinCpuProxy {
-		return 1
+	return nil, false
+}
+
+// LifecycleDownloadURL is where containers download a lifecycle bundle from.
+func LifecycleDownloadURL(lifecyclePath string, fileServerURL string) string {
+	staticPath, err := routes.FileServerRoutes.CreatePathForRoute(routes.FS_STATIC, nil)
+	if err != nil {
+		panic("couldn't generate the download path for the bundle of app lifecycle binaries: " + err.Error())
 	}
 
-	return uint(99.0*(cpuProxy-MinCpuProxy)/(MaxCpuProxy-MinCpuProxy) + 1)
+	return urljoiner.Join(fileServerURL, staticPath, lifecyclePath)
+}
+
+func portFlag(port uint16) string {
+	return fmt.Sprintf("-port=%d", port)
 }
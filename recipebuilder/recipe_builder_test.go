@@ -17,6 +17,8 @@ import (
 var _ = Describe("Recipe Builder", func() {
 	var (
 		builder       *recipebuilder.RecipeBuilder
+		config        recipebuilder.Config
+		logger        lager.Logger
 		err           error
 		desiredAppReq cc_messages.DesireAppRequestFromCC
 		desiredLRP    *receptor.DesiredLRPCreateRequest
@@ -27,7 +29,7 @@ var _ = Describe("Recipe Builder", func() {
 	defaultNofile := recipebuilder.DefaultFileDescriptorLimit
 
 	BeforeEach(func() {
-		logger := lager.NewLogger("fakelogger")
+		logger = lager.NewLogger("fakelogger")
 
 		lifecycles = map[string]string{
 			"some-stack": "some-lifecycle.tgz",
@@ -41,7 +43,11 @@ var _ = Describe("Recipe Builder", func() {
 			},
 		}
 
-		builder = recipebuilder.New(lifecycles, "the/docker/lifecycle/path.tgz", "http://file-server.com", logger)
+		config = recipebuilder.Config{
+			Lifecycles:          lifecycles,
+			DockerLifecyclePath: "the/docker/lifecycle/path.tgz",
+			FileServerURL:       "http://file-server.com",
+		}
 
 		desiredAppReq = cc_messages.DesireAppRequestFromCC{
 			ProcessGuid:       "the-app-guid-the-app-version",
@@ -69,6 +75,7 @@ var _ = Describe("Recipe Builder", func() {
 	})
 
 	JustBeforeEach(func() {
+		builder = recipebuilder.New(config, logger)
 		desiredLRP, err = builder.Build(&desiredAppReq)
 	})
 
@@ -112,12 +119,12 @@ var _ = Describe("Recipe Builder", func() {
 			Ω(desiredLRP.Routes).Should(Equal(cfroutes.CFRoutes{
 				{Hostnames: []string{"route1", "route2"}, Port: 8080},
 			}.RoutingInfo()))
-			Ω(desiredLRP.Annotation).Should(Equal("etag-updated-at"))
+			Ω(desiredLRP.Annotation).Should(Equal(recipebuilder.NewAnnotation("etag-updated-at").String()))
 			Ω(desiredLRP.Stack).Should(Equal("some-stack"))
 			Ω(desiredLRP.MemoryMB).Should(Equal(128))
 			Ω(desiredLRP.DiskMB).Should(Equal(512))
 			Ω(desiredLRP.Ports).Should(Equal([]uint16{8080}))
-			Ω(desiredLRP.Privileged).Should(BeTrue())
+			Ω(desiredLRP.Privileged).Should(BeFalse())
 			Ω(desiredLRP.StartTimeout).Should(Equal(uint(123456)))
 
 			Ω(desiredLRP.LogGuid).Should(Equal("the-log-id"))
@@ -228,12 +235,227 @@ var _ = Describe("Recipe Builder", func() {
 				Ω(downloadDestinations).Should(ContainElement("/tmp/lifecycle"))
 			})
 		})
+
+		Context("when the 'process' health check is specified", func() {
+			BeforeEach(func() {
+				desiredAppReq.HealthCheckType = recipebuilder.ProcessHealthCheckType
+			})
+
+			It("does not error", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("does not populate the monitor action", func() {
+				Ω(desiredLRP.Monitor).Should(BeNil())
+			})
+
+			It("still runs the launcher", func() {
+				runAction, ok := desiredLRP.Action.(*models.RunAction)
+				Ω(ok).Should(BeTrue())
+				Ω(runAction.Path).Should(Equal("/tmp/lifecycle/launcher"))
+			})
+		})
+
+		Context("when the 'http' health check is specified", func() {
+			BeforeEach(func() {
+				desiredAppReq.HealthCheckType = recipebuilder.HTTPHealthCheckType
+				desiredAppReq.HealthCheckHTTPEndpoint = "/health"
+			})
+
+			It("checks the endpoint on the app port", func() {
+				Ω(desiredLRP.Monitor).Should(Equal(&models.TimeoutAction{
+					Timeout: 30 * time.Second,
+					Action: &models.RunAction{
+						Path:           "/tmp/lifecycle/healthcheck",
+						Args:           []string{"-port=8080", "-uri=/health", "-timeout=1s", "-interval=1s"},
+						LogSource:      "HEALTH",
+						ResourceLimits: models.ResourceLimits{Nofile: &defaultNofile},
+					},
+				}))
+			})
+
+			Context("when the builder is configured with health check timeouts", func() {
+				BeforeEach(func() {
+					config.HealthCheckTimeout = 10 * time.Second
+					config.HealthCheckProbeTimeout = 5 * time.Second
+				})
+
+				It("uses them instead of the defaults", func() {
+					timeoutAction := desiredLRP.Monitor.(*models.TimeoutAction)
+					Ω(timeoutAction.Timeout).Should(Equal(10 * time.Second))
+					Ω(timeoutAction.Action.(*models.RunAction).Args).Should(ContainElement("-timeout=5s"))
+				})
+			})
+
+			Context("when the builder is configured with a health check interval", func() {
+				BeforeEach(func() {
+					config.HealthCheckInterval = 3 * time.Second
+				})
+
+				It("waits that long between probes", func() {
+					timeoutAction := desiredLRP.Monitor.(*models.TimeoutAction)
+					Ω(timeoutAction.Action.(*models.RunAction).Args).Should(ContainElement("-interval=3s"))
+				})
+			})
+
+			Context("when the desire message carries a probe timeout and interval", func() {
+				BeforeEach(func() {
+					config.HealthCheckProbeTimeout = 5 * time.Second
+					config.HealthCheckInterval = 3 * time.Second
+
+					desiredAppReq.HealthCheckProbeTimeoutInSeconds = 2
+					desiredAppReq.HealthCheckIntervalInSeconds = 10
+				})
+
+				It("prefers them over the builder defaults", func() {
+					timeoutAction := desiredLRP.Monitor.(*models.TimeoutAction)
+					Ω(timeoutAction.Action.(*models.RunAction).Args).Should(ContainElement("-timeout=2s"))
+					Ω(timeoutAction.Action.(*models.RunAction).Args).Should(ContainElement("-interval=10s"))
+				})
+			})
+
+			Context("when the probe timeout exceeds the health check timeout", func() {
+				BeforeEach(func() {
+					config.HealthCheckTimeout = 2 * time.Second
+					config.HealthCheckProbeTimeout = 5 * time.Second
+				})
+
+				It("caps the probe timeout", func() {
+					timeoutAction := desiredLRP.Monitor.(*models.TimeoutAction)
+					Ω(timeoutAction.Action.(*models.RunAction).Args).Should(ContainElement("-timeout=2s"))
+				})
+
+				Context("and it comes from the desire message", func() {
+					BeforeEach(func() {
+						desiredAppReq.HealthCheckProbeTimeoutInSeconds = 5
+					})
+
+					It("caps it too", func() {
+						timeoutAction := desiredLRP.Monitor.(*models.TimeoutAction)
+						Ω(timeoutAction.Action.(*models.RunAction).Args).Should(ContainElement("-timeout=2s"))
+					})
+				})
+			})
+
+			Context("when the endpoint is not an absolute path", func() {
+				BeforeEach(func() {
+					desiredAppReq.HealthCheckHTTPEndpoint = "health"
+				})
+
+				It("errors", func() {
+					Ω(err).Should(MatchError(recipebuilder.ErrInvalidHealthCheckEndpoint))
+				})
+			})
+
+			Context("when the endpoint is missing", func() {
+				BeforeEach(func() {
+					desiredAppReq.HealthCheckHTTPEndpoint = ""
+				})
+
+				It("errors", func() {
+					Ω(err).Should(MatchError(recipebuilder.ErrInvalidHealthCheckEndpoint))
+				})
+			})
+		})
+
+		Context("when the builder is configured with a health check timeout", func() {
+			BeforeEach(func() {
+				config.HealthCheckTimeout = 45 * time.Second
+			})
+
+			It("applies it to the port check", func() {
+				Ω(desiredLRP.Monitor.(*models.TimeoutAction).Timeout).Should(Equal(45 * time.Second))
+			})
+		})
+
+		Context("when an unknown health check is specified", func() {
+			BeforeEach(func() {
+				desiredAppReq.HealthCheckType = cc_messages.HealthCheckType("carrier-pigeon")
+			})
+
+			It("errors", func() {
+				Ω(err).Should(MatchError(recipebuilder.UnsupportedHealthCheckTypeError{
+					HealthCheckType: "carrier-pigeon",
+				}))
+			})
+
+			It("does not build a desired LRP", func() {
+				Ω(desiredLRP).Should(BeNil())
+			})
+		})
+	})
+
+	Context("when the app exposes several ports", func() {
+		BeforeEach(func() {
+			desiredAppReq.Ports = []uint16{9090, 9091}
+			desiredAppReq.PortRoutes = []cc_messages.PortRoutes{
+				{Port: 9091, Hostnames: []string{"admin-route"}},
+			}
+		})
+
+		It("exposes every port", func() {
+			Ω(desiredLRP.Ports).Should(Equal([]uint16{9090, 9091}))
+		})
+
+		It("routes each port's hostnames", func() {
+			Ω(desiredLRP.Routes).Should(Equal(cfroutes.CFRoutes{
+				{Hostnames: []string{"route1", "route2"}, Port: 9090},
+				{Hostnames: []string{"admin-route"}, Port: 9091},
+			}.RoutingInfo()))
+		})
+
+		It("exports the primary port as $PORT", func() {
+			runAction := desiredLRP.Action.(*models.RunAction)
+			Ω(runAction.Env).Should(ContainElement(models.EnvironmentVariable{
+				Name:  "PORT",
+				Value: "9090",
+			}))
+		})
+
+		It("health checks the primary port", func() {
+			runAction := desiredLRP.Monitor.(*models.TimeoutAction).Action.(*models.RunAction)
+			Ω(runAction.Args).Should(Equal([]string{"-port=9090"}))
+		})
+
+		Context("and chooses the health check port", func() {
+			BeforeEach(func() {
+				desiredAppReq.HealthCheckPort = 9091
+			})
+
+			It("health checks that port", func() {
+				runAction := desiredLRP.Monitor.(*models.TimeoutAction).Action.(*models.RunAction)
+				Ω(runAction.Args).Should(Equal([]string{"-port=9091"}))
+			})
+		})
+
+		Context("and chooses a health check port it does not expose", func() {
+			BeforeEach(func() {
+				desiredAppReq.HealthCheckPort = 7070
+			})
+
+			It("errors", func() {
+				Ω(err).Should(MatchError(recipebuilder.ErrHealthCheckPortUnused))
+			})
+		})
+
+		Context("and routes a port it does not expose", func() {
+			BeforeEach(func() {
+				desiredAppReq.PortRoutes = []cc_messages.PortRoutes{
+					{Port: 7070, Hostnames: []string{"nowhere"}},
+				}
+			})
+
+			It("errors", func() {
+				Ω(err).Should(MatchError(recipebuilder.ErrRoutePortNotExposed))
+			})
+		})
 	})
 
 	Context("when there is a docker image url instead of a droplet uri", func() {
 		BeforeEach(func() {
 			desiredAppReq.DockerImageUrl = "user/repo:tag"
 			desiredAppReq.DropletUri = ""
+			desiredAppReq.ExecutionMetadata = `{"cmd":["the-docker-command"]}`
 		})
 
 		It("does not error", func() {
@@ -255,6 +477,97 @@ var _ = Describe("Recipe Builder", func() {
 			}))
 		})
 
+		It("uses the default port when the image exposes none", func() {
+			Ω(desiredLRP.Ports).Should(Equal([]uint16{8080}))
+		})
+
+		Context("and the image exposes a port", func() {
+			BeforeEach(func() {
+				desiredAppReq.ExecutionMetadata = `{"cmd":["the-docker-command"],"ports":[{"port":9090,"protocol":"tcp"}]}`
+			})
+
+			It("exposes that port", func() {
+				Ω(desiredLRP.Ports).Should(Equal([]uint16{9090}))
+			})
+
+			It("routes to that port", func() {
+				Ω(desiredLRP.Routes).Should(Equal(cfroutes.CFRoutes{
+					{Hostnames: []string{"route1", "route2"}, Port: 9090},
+				}.RoutingInfo()))
+			})
+
+			It("exports that port as $PORT", func() {
+				runAction := desiredLRP.Action.(*models.RunAction)
+				Ω(runAction.Env).Should(ContainElement(models.EnvironmentVariable{
+					Name:  "PORT",
+					Value: "9090",
+				}))
+			})
+
+			It("health checks that port", func() {
+				runAction := desiredLRP.Monitor.(*models.TimeoutAction).Action.(*models.RunAction)
+				Ω(runAction.Args).Should(Equal([]string{"-port=9090"}))
+			})
+		})
+
+		Context("and the docker image url names a registry and a digest", func() {
+			BeforeEach(func() {
+				desiredAppReq.DockerImageUrl = "registry.example.com:5000/org/repo@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+			})
+
+			It("pins the rootfs to the digest on that registry", func() {
+				Ω(desiredLRP.RootFSPath).Should(Equal("docker://registry.example.com:5000/org/repo#sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"))
+			})
+		})
+
+		Context("and the builder has docker registry rules", func() {
+			BeforeEach(func() {
+				config.DockerRegistryRules = recipebuilder.DockerRegistryRules{
+					{Registry: "evil.example.com", Deny: true},
+					{Registry: "docker.io", Mirror: "mirror.internal:5000"},
+				}
+			})
+
+			It("pulls the image from the mirror", func() {
+				Ω(desiredLRP.RootFSPath).Should(Equal("docker://mirror.internal:5000/user/repo#tag"))
+			})
+
+			Context("and the image comes from a denied registry", func() {
+				BeforeEach(func() {
+					desiredAppReq.DockerImageUrl = "evil.example.com/user/repo:tag"
+				})
+
+				It("refuses to build the app", func() {
+					Ω(err).Should(BeAssignableToTypeOf(recipebuilder.DeniedDockerImageError{}))
+					Ω(desiredLRP).Should(BeNil())
+				})
+			})
+		})
+
+		Context("and the docker image url is invalid", func() {
+			BeforeEach(func() {
+				desiredAppReq.DockerImageUrl = "User/Repo:tag"
+			})
+
+			It("errors", func() {
+				Ω(err).Should(BeAssignableToTypeOf(recipebuilder.InvalidDockerReferenceError{}))
+			})
+
+			It("does not build a desired LRP", func() {
+				Ω(desiredLRP).Should(BeNil())
+			})
+		})
+
+		Context("and the execution metadata is invalid", func() {
+			BeforeEach(func() {
+				desiredAppReq.ExecutionMetadata = "the-execution-metadata"
+			})
+
+			It("errors", func() {
+				Ω(err).Should(MatchError(recipebuilder.ErrInvalidExecutionMetadata))
+			})
+		})
+
 		Context("and the docker image url has no tag", func() {
 			BeforeEach(func() {
 				desiredAppReq.DockerImageUrl = "user/repo"
@@ -266,6 +579,104 @@ var _ = Describe("Recipe Builder", func() {
 		})
 	})
 
+	Describe("BuildUpdate", func() {
+		var (
+			updateRequest *receptor.DesiredLRPUpdateRequest
+			updateErr     error
+		)
+
+		JustBeforeEach(func() {
+			updateRequest, updateErr = builder.BuildUpdate(&desiredAppReq)
+		})
+
+		It("updates the instances, annotation and routes", func() {
+			Ω(updateErr).ShouldNot(HaveOccurred())
+			Ω(*updateRequest.Instances).Should(Equal(23))
+			Ω(*updateRequest.Annotation).Should(Equal(recipebuilder.NewAnnotation("etag-updated-at").String()))
+			Ω(updateRequest.Routes).Should(Equal(desiredLRP.Routes))
+		})
+
+		Context("when the docker image exposes a port", func() {
+			BeforeEach(func() {
+				desiredAppReq.DockerImageUrl = "user/repo:tag"
+				desiredAppReq.DropletUri = ""
+				desiredAppReq.ExecutionMetadata = `{"ports":[{"port":9090,"protocol":"tcp"}]}`
+			})
+
+			It("routes the same port as the create request", func() {
+				Ω(updateRequest.Routes).Should(Equal(cfroutes.CFRoutes{
+					{Hostnames: []string{"route1", "route2"}, Port: 9090},
+				}.RoutingInfo()))
+			})
+		})
+
+		Context("when the routes are invalid", func() {
+			BeforeEach(func() {
+				desiredAppReq.PortRoutes = []cc_messages.PortRoutes{
+					{Port: 7070, Hostnames: []string{"nowhere"}},
+				}
+			})
+
+			It("errors", func() {
+				Ω(updateErr).Should(MatchError(recipebuilder.ErrRoutePortNotExposed))
+			})
+		})
+
+		Context("when a route is not a valid hostname", func() {
+			BeforeEach(func() {
+				desiredAppReq.Routes = []string{"good.example.com", "-bad-.example.com"}
+			})
+
+			It("rejects the update like the create", func() {
+				Ω(updateErr).Should(BeAssignableToTypeOf(recipebuilder.ValidationError{}))
+				Ω(updateErr).Should(MatchError(ContainSubstring(`route "-bad-.example.com" is not a valid hostname`)))
+				Ω(updateRequest).Should(BeNil())
+			})
+		})
+
+		Context("when the instances exceed the resource policy's cap", func() {
+			BeforeEach(func() {
+				config.ResourcePolicy.MaxInstances = 10
+			})
+
+			It("rejects the update like the create", func() {
+				Ω(updateErr).Should(BeAssignableToTypeOf(recipebuilder.ValidationError{}))
+				Ω(updateErr).Should(MatchError(ContainSubstring("num_instances 23 exceeds the limit of 10")))
+			})
+		})
+	})
+
+	Context("when the docker lifecycle is disabled", func() {
+		BeforeEach(func() {
+			config.EnabledLifecycles = []string{recipebuilder.BuildpackLifecycleName}
+		})
+
+		It("still builds buildpack apps", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("and the app is a docker app", func() {
+			BeforeEach(func() {
+				desiredAppReq.DockerImageUrl = "user/repo:tag"
+				desiredAppReq.DropletUri = ""
+			})
+
+			It("errors", func() {
+				Ω(err).Should(MatchError(recipebuilder.ErrNoLifecycleForApp))
+			})
+		})
+	})
+
+	Context("when the buildpack lifecycle is disabled", func() {
+		BeforeEach(func() {
+			config.EnabledLifecycles = []string{recipebuilder.DockerLifecycleName}
+		})
+
+		It("errors for buildpack apps", func() {
+			Ω(err).Should(MatchError(recipebuilder.ErrNoLifecycleForApp))
+		})
+	})
+
 	Context("when there is a docker image url AND a droplet uri", func() {
 		BeforeEach(func() {
 			desiredAppReq.DockerImageUrl = "user/repo:tag"
@@ -0,0 +1,62 @@
+package recipebuilder
+
+import "fmt"
+
+// ResourceBounds limit the memory and disk an app may ask for. Requests below
+// a minimum are raised to it, while requests above a maximum are rejected:
+// Diego enforces memory and disk as hard container limits, so lowering them
+// would leave the app with less than it needs. Zero values are unbounded.
+type ResourceBounds struct {
+	MinMemoryMB int `json:"min_memory_mb,omitempty"`
+	MaxMemoryMB int `json:"max_memory_mb,omitempty"`
+	MinDiskMB   int `json:"min_disk_mb,omitempty"`
+	MaxDiskMB   int `json:"max_disk_mb,omitempty"`
+}
+
+func (b ResourceBounds) validate() error {
+	if b.MinMemoryMB < 0 || b.MaxMemoryMB < 0 || b.MinDiskMB < 0 || b.MaxDiskMB < 0 {
+		return fmt.Errorf("resource bounds must not be negative")
+	}
+
+	if b.MaxMemoryMB != 0 && b.MinMemoryMB > b.MaxMemoryMB {
+		return fmt.Errorf("min_memory_mb exceeds max_memory_mb")
+	}
+
+	if b.MaxDiskMB != 0 && b.MinDiskMB > b.MaxDiskMB {
+		return fmt.Errorf("min_disk_mb exceeds max_disk_mb")
+	}
+
+	return nil
+}
+
+func (b ResourceBounds) memoryMB(requested int) int {
+	return raise(requested, b.MinMemoryMB)
+}
+
+func (b ResourceBounds) diskMB(requested int) int {
+	return raise(requested, b.MinDiskMB)
+}
+
+// errors reports the memory and disk above the maximums.
+func (b ResourceBounds) errors(memoryMB, diskMB int) []error {
+	errs := []error{}
+
+	if b.MaxMemoryMB != 0 && memoryMB > b.MaxMemoryMB {
+		errs = append(errs, fmt.Errorf("memory_mb %d exceeds the limit of %d", memoryMB, b.MaxMemoryMB))
+	}
+
+	if b.MaxDiskMB != 0 && diskMB > b.MaxDiskMB {
+		errs = append(errs, fmt.Errorf("disk_mb %d exceeds the limit of %d", diskMB, b.MaxDiskMB))
+	}
+
+	return errs
+}
+
+// raise leaves negative requests alone, so that validation rejects them.
+func raise(requested, min int) int {
+	if requested >= 0 && requested < min {
+		return min
+	}
+
+	return requested
+}
@@ -0,0 +1,117 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+type CPUWeightCurve string
+
+const (
+	// LinearCPUWeightCurve grows an app's CPU weight with its memory.
+	LinearCPUWeightCurve CPUWeightCurve = "linear"
+	// SqrtCPUWeightCurve grows it with the square root of its memory,
+	// giving small apps a larger share than the linear curve does.
+	SqrtCPUWeightCurve CPUWeightCurve = "sqrt"
+
+	DefaultCPUWeightCurve = LinearCPUWeightCurve
+)
+
+// A ResourcePolicy bounds the resources of every app. Zero values pass the
+// app's request through unchanged.
+//
+// The memory and disk overcommit factors of the original design are not
+// supported: this receptor only knows one memory and disk size per LRP, which
+// is both what the cell reserves and the hard limit of the container, so
+// overcommitting it would shrink the app. Overcommit the cells' advertised
+// capacity instead.
+type ResourcePolicy struct {
+	ResourceBounds
+
+	// MaxInstances rejects creates and updates of apps with more instances.
+	MaxInstances int `json:"max_instances,omitempty"`
+
+	CPUWeightCurve CPUWeightCurve `json:"cpu_weight_curve,omitempty"`
+}
+
+// unsupportedPolicyFields are the overcommit factors, rejected so that a
+// policy asking for them fails loudly instead of being ignored.
+var unsupportedPolicyFields = []string{"memory_overcommit", "disk_overcommit"}
+
+func LoadResourcePolicy(path string) (ResourcePolicy, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ResourcePolicy{}, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(contents, &fields)
+	if err != nil {
+		return ResourcePolicy{}, err
+	}
+
+	for _, field := range unsupportedPolicyFields {
+		if _, found := fields[field]; found {
+			return ResourcePolicy{}, fmt.Errorf("%s is not supported: it would shrink the app's container limit; overcommit the cells' capacity instead", field)
+		}
+	}
+
+	policy := ResourcePolicy{}
+	err = json.Unmarshal(contents, &policy)
+	if err != nil {
+		return ResourcePolicy{}, err
+	}
+
+	err = policy.Validate()
+	if err != nil {
+		return ResourcePolicy{}, err
+	}
+
+	return policy, nil
+}
+
+func (p ResourcePolicy) Validate() error {
+	err := p.ResourceBounds.validate()
+	if err != nil {
+		return err
+	}
+
+	if p.MaxInstances < 0 {
+		return fmt.Errorf("max_instances must not be negative")
+	}
+
+	switch p.CPUWeightCurve {
+	case "", LinearCPUWeightCurve, SqrtCPUWeightCurve:
+	default:
+		return fmt.Errorf("unknown cpu_weight_curve %q; expected linear or sqrt", p.CPUWeightCurve)
+	}
+
+	return nil
+}
+
+func (p ResourcePolicy) instancesError(instances int) error {
+	if p.MaxInstances > 0 && instances > p.MaxInstances {
+		return fmt.Errorf("num_instances %d exceeds the limit of %d", instances, p.MaxInstances)
+	}
+
+	return nil
+}
+
+func (p ResourcePolicy) cpuWeight(memoryMB int) uint {
+	if memoryMB > MaxCpuProxy {
+		return 100
+	}
+
+	if memoryMB < MinCpuProxy {
+		return 1
+	}
+
+	if p.CPUWeightCurve == SqrtCPUWeightCurve {
+		share := float64(memoryMB-MinCpuProxy) / float64(MaxCpuProxy-MinCpuProxy)
+		return uint(99.0*math.Sqrt(share) + 1)
+	}
+
+	return uint(99*(memoryMB-MinCpuProxy)/(MaxCpuProxy-MinCpuProxy) + 1)
+}
@@ -0,0 +1,217 @@
+package recipebuilder_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resource Policy", func() {
+	Describe("LoadResourcePolicy", func() {
+		var path string
+
+		writePolicy := func(contents string) {
+			err := ioutil.WriteFile(path, []byte(contents), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "resource-policy")
+			Ω(err).ShouldNot(HaveOccurred())
+			file.Close()
+
+			path = file.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("loads the policy", func() {
+			writePolicy(`{
+				"min_memory_mb": 64,
+				"max_memory_mb": 4096,
+				"max_instances": 50,
+				"cpu_weight_curve": "sqrt"
+			}`)
+
+			policy, err := recipebuilder.LoadResourcePolicy(path)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policy).Should(Equal(recipebuilder.ResourcePolicy{
+				ResourceBounds: recipebuilder.ResourceBounds{
+					MinMemoryMB: 64,
+					MaxMemoryMB: 4096,
+				},
+				MaxInstances:   50,
+				CPUWeightCurve: recipebuilder.SqrtCPUWeightCurve,
+			}))
+		})
+
+		It("rejects overcommit factors, which would shrink the app's container limits", func() {
+			writePolicy(`{"memory_overcommit": 2}`)
+
+			_, err := recipebuilder.LoadResourcePolicy(path)
+			Ω(err).Should(MatchError(ContainSubstring("memory_overcommit is not supported")))
+
+			writePolicy(`{"disk_overcommit": 2}`)
+
+			_, err = recipebuilder.LoadResourcePolicy(path)
+			Ω(err).Should(MatchError(ContainSubstring("disk_overcommit is not supported")))
+		})
+
+		It("rejects inverted bounds", func() {
+			writePolicy(`{"min_disk_mb": 2048, "max_disk_mb": 1024}`)
+
+			_, err := recipebuilder.LoadResourcePolicy(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects negative instance caps", func() {
+			writePolicy(`{"max_instances": -1}`)
+
+			_, err := recipebuilder.LoadResourcePolicy(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects unknown cpu weight curves", func() {
+			writePolicy(`{"cpu_weight_curve": "exponential"}`)
+
+			_, err := recipebuilder.LoadResourcePolicy(path)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("building with a policy", func() {
+		var (
+			policy     recipebuilder.ResourcePolicy
+			desiredApp cc_messages.DesireAppRequestFromCC
+
+			desiredLRP *receptor.DesiredLRPCreateRequest
+			err        error
+		)
+
+		BeforeEach(func() {
+			policy = recipebuilder.ResourcePolicy{}
+
+			desiredApp = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:  "the-app-guid",
+				DropletUri:   "http://the-droplet.uri.com",
+				Stack:        "some-stack",
+				MemoryMB:     1000,
+				DiskMB:       3000,
+				NumInstances: 1,
+			}
+		})
+
+		JustBeforeEach(func() {
+			builder := recipebuilder.New(recipebuilder.Config{
+				Lifecycles:     map[string]string{"some-stack": "some-lifecycle.tgz"},
+				FileServerURL:  "http://file-server.com",
+				ResourcePolicy: policy,
+			}, lager.NewLogger("fakelogger"))
+
+			desiredLRP, err = builder.Build(&desiredApp)
+		})
+
+		It("passes the request through by default", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desiredLRP.MemoryMB).Should(Equal(1000))
+			Ω(desiredLRP.DiskMB).Should(Equal(3000))
+		})
+
+		It("gives the app the memory limit it asked for", func() {
+			Ω(desiredLRP.Action.(*models.RunAction).Env).Should(ContainElement(models.EnvironmentVariable{
+				Name:  "MEMORY_LIMIT",
+				Value: "1000m",
+			}))
+		})
+
+		Context("with bounds the request falls within", func() {
+			BeforeEach(func() {
+				policy.MinMemoryMB = 512
+				policy.MaxMemoryMB = 2048
+				policy.MinDiskMB = 1024
+				policy.MaxDiskMB = 4096
+			})
+
+			It("leaves the app's limits unchanged", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(desiredLRP.MemoryMB).Should(Equal(1000))
+				Ω(desiredLRP.DiskMB).Should(Equal(3000))
+				Ω(desiredLRP.Action.(*models.RunAction).Env).Should(ContainElement(models.EnvironmentVariable{
+					Name:  "MEMORY_LIMIT",
+					Value: "1000m",
+				}))
+			})
+		})
+
+		Context("with a minimum above the request", func() {
+			BeforeEach(func() {
+				policy.MinMemoryMB = 2048
+			})
+
+			It("raises the limit and tells the app its memory limit", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(desiredLRP.MemoryMB).Should(Equal(2048))
+				Ω(desiredLRP.Action.(*models.RunAction).Env).Should(ContainElement(models.EnvironmentVariable{
+					Name:  "MEMORY_LIMIT",
+					Value: "2048m",
+				}))
+			})
+
+			Context("and a negative request", func() {
+				BeforeEach(func() {
+					desiredApp.MemoryMB = -1
+				})
+
+				It("still rejects the request", func() {
+					Ω(err).Should(MatchError(ContainSubstring("memory_mb -1 must not be negative")))
+				})
+			})
+		})
+
+		Context("with a maximum below the request", func() {
+			BeforeEach(func() {
+				policy.MaxMemoryMB = 512
+				policy.MaxDiskMB = 1024
+			})
+
+			It("rejects the app rather than shrinking its limits", func() {
+				Ω(err).Should(BeAssignableToTypeOf(recipebuilder.ValidationError{}))
+				Ω(err).Should(MatchError(ContainSubstring("memory_mb 1000 exceeds the limit of 512")))
+				Ω(err).Should(MatchError(ContainSubstring("disk_mb 3000 exceeds the limit of 1024")))
+				Ω(desiredLRP).Should(BeNil())
+			})
+		})
+
+		Context("with an instance cap", func() {
+			BeforeEach(func() {
+				policy.MaxInstances = 5
+				desiredApp.NumInstances = 6
+			})
+
+			It("rejects the app", func() {
+				Ω(err).Should(BeAssignableToTypeOf(recipebuilder.ValidationError{}))
+			})
+		})
+
+		Context("with the sqrt cpu weight curve", func() {
+			BeforeEach(func() {
+				policy.CPUWeightCurve = recipebuilder.SqrtCPUWeightCurve
+				desiredApp.MemoryMB = recipebuilder.MinCpuProxy + (recipebuilder.MaxCpuProxy-recipebuilder.MinCpuProxy)/4
+			})
+
+			It("weighs small apps more heavily than the linear curve", func() {
+				Ω(desiredLRP.CPUWeight).Should(Equal(uint(50)))
+			})
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package recipebuilder
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/route-emitter/cfroutes"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+)
+
+var (
+	ErrInvalidPort           = errors.New("desired app ports must be non-zero")
+	ErrDuplicatePort         = errors.New("desired app ports must be unique")
+	ErrRoutePortNotExposed   = errors.New("desired app routes a port it does not expose")
+	ErrHealthCheckPortUnused = errors.New("desired app health check port is not one of its ports")
+)
+
+// Ports returns the container ports of the desired app. The first port is the
+// app's primary port: it receives the app's default routes and is exported
+// as $PORT. Docker apps that do not list their ports get the port their image
+// exposes.
+func (b *RecipeBuilder) Ports(desiredApp *cc_messages.DesireAppRequestFromCC) ([]uint16, error) {
+	if len(desiredApp.Ports) == 0 {
+		if desiredApp.DockerImageUrl == "" {
+			return []uint16{DefaultPort}, nil
+		}
+
+		port, err := b.dockerPort(desiredApp.ExecutionMetadata)
+		if err != nil {
+			return nil, err
+		}
+
+		return []uint16{port}, nil
+	}
+
+	seen := make(map[uint16]struct{}, len(desiredApp.Ports))
+	for _, port := range desiredApp.Ports {
+		if port == 0 {
+			return nil, ErrInvalidPort
+		}
+
+		if _, found := seen[port]; found {
+			return nil, ErrDuplicatePort
+		}
+
+		seen[port] = struct{}{}
+	}
+
+	return desiredApp.Ports, nil
+}
+
+// HealthCheckPort returns the port the desired app's health check targets.
+func (b *RecipeBuilder) HealthCheckPort(desiredApp *cc_messages.DesireAppRequestFromCC) (uint16, error) {
+	ports, err := b.Ports(desiredApp)
+	if err != nil {
+		return 0, err
+	}
+
+	if desiredApp.HealthCheckPort == 0 {
+		return ports[0], nil
+	}
+
+	for _, port := range ports {
+		if port == desiredApp.HealthCheckPort {
+			return port, nil
+		}
+	}
+
+	return 0, ErrHealthCheckPortUnused
+}
+
+// RoutingInfo builds the routes of the desired app, with one entry per
+// container port in port order. Create and update requests must both use it
+// so that an update never drops the routes of a port.
+func (b *RecipeBuilder) RoutingInfo(desiredApp *cc_messages.DesireAppRequestFromCC) (receptor.RoutingInfo, error) {
+	ports, err := b.Ports(desiredApp)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make(cfroutes.CFRoutes, len(ports))
+	byPort := make(map[uint16]*cfroutes.CFRoute, len(ports))
+	for i, port := range ports {
+		routes[i] = cfroutes.CFRoute{Port: port}
+		byPort[port] = &routes[i]
+	}
+
+	primary := byPort[ports[0]]
+	primary.Hostnames = append(primary.Hostnames, desiredApp.Routes...)
+
+	for _, portRoutes := range desiredApp.PortRoutes {
+		route, found := byPort[portRoutes.Port]
+		if !found {
+			return nil, ErrRoutePortNotExposed
+		}
+
+		route.Hostnames = append(route.Hostnames, portRoutes.Hostnames...)
+	}
+
+	return routes.RoutingInfo(), nil
+}
+
+func (b *RecipeBuilder) dockerPort(executionMetadata string) (uint16, error) {
+	metadata, err := parseDockerExecutionMetadata(executionMetadata)
+	if err != nil {
+		return 0, err
+	}
+
+	ports, err := metadata.exposedTCPPorts()
+	if err != nil {
+		return 0, err
+	}
+
+	return b.dockerPortRule.selectPort(ports)
+}
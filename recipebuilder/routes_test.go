@@ -0,0 +1,172 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/route-emitter/cfroutes"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Routes", func() {
+	var (
+		builder    *recipebuilder.RecipeBuilder
+		desiredApp cc_messages.DesireAppRequestFromCC
+	)
+
+	BeforeEach(func() {
+		builder = recipebuilder.New(recipebuilder.Config{}, lager.NewLogger("fakelogger"))
+
+		desiredApp = cc_messages.DesireAppRequestFromCC{
+			ProcessGuid: "the-app-guid",
+			Routes:      []string{"route1", "route2"},
+		}
+	})
+
+	Describe("Ports", func() {
+		It("defaults to the default port", func() {
+			ports, err := builder.Ports(&desiredApp)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ports).Should(Equal([]uint16{8080}))
+		})
+
+		Context("when the app exposes ports", func() {
+			BeforeEach(func() {
+				desiredApp.Ports = []uint16{9090, 9091}
+			})
+
+			It("returns them in order", func() {
+				ports, err := builder.Ports(&desiredApp)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ports).Should(Equal([]uint16{9090, 9091}))
+			})
+		})
+
+		Context("when a docker app does not list its ports", func() {
+			BeforeEach(func() {
+				desiredApp.DockerImageUrl = "user/repo"
+				desiredApp.ExecutionMetadata = `{"ports":[{"port":8081,"protocol":"tcp"}]}`
+			})
+
+			It("uses the port its image exposes", func() {
+				ports, err := builder.Ports(&desiredApp)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ports).Should(Equal([]uint16{8081}))
+			})
+
+			Context("and it lists its ports", func() {
+				BeforeEach(func() {
+					desiredApp.Ports = []uint16{9090}
+				})
+
+				It("prefers the listed ports", func() {
+					ports, err := builder.Ports(&desiredApp)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(ports).Should(Equal([]uint16{9090}))
+				})
+			})
+		})
+
+		Context("when a port is repeated", func() {
+			BeforeEach(func() {
+				desiredApp.Ports = []uint16{9090, 9090}
+			})
+
+			It("errors", func() {
+				_, err := builder.Ports(&desiredApp)
+				Ω(err).Should(MatchError(recipebuilder.ErrDuplicatePort))
+			})
+		})
+
+		Context("when a port is zero", func() {
+			BeforeEach(func() {
+				desiredApp.Ports = []uint16{0}
+			})
+
+			It("errors", func() {
+				_, err := builder.Ports(&desiredApp)
+				Ω(err).Should(MatchError(recipebuilder.ErrInvalidPort))
+			})
+		})
+	})
+
+	Describe("HealthCheckPort", func() {
+		BeforeEach(func() {
+			desiredApp.Ports = []uint16{9090, 9091}
+		})
+
+		It("defaults to the primary port", func() {
+			port, err := builder.HealthCheckPort(&desiredApp)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(port).Should(Equal(uint16(9090)))
+		})
+
+		Context("when the app chooses one of its ports", func() {
+			BeforeEach(func() {
+				desiredApp.HealthCheckPort = 9091
+			})
+
+			It("returns it", func() {
+				port, err := builder.HealthCheckPort(&desiredApp)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(port).Should(Equal(uint16(9091)))
+			})
+		})
+
+		Context("when the app chooses a port it does not expose", func() {
+			BeforeEach(func() {
+				desiredApp.HealthCheckPort = 7070
+			})
+
+			It("errors", func() {
+				_, err := builder.HealthCheckPort(&desiredApp)
+				Ω(err).Should(MatchError(recipebuilder.ErrHealthCheckPortUnused))
+			})
+		})
+	})
+
+	Describe("RoutingInfo", func() {
+		It("routes the app's hostnames to the default port", func() {
+			routingInfo, err := builder.RoutingInfo(&desiredApp)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(routingInfo).Should(Equal(cfroutes.CFRoutes{
+				{Hostnames: []string{"route1", "route2"}, Port: 8080},
+			}.RoutingInfo()))
+		})
+
+		Context("when the app exposes several ports with their own hostnames", func() {
+			BeforeEach(func() {
+				desiredApp.Ports = []uint16{9090, 9091, 9092}
+				desiredApp.PortRoutes = []cc_messages.PortRoutes{
+					{Port: 9092, Hostnames: []string{"admin"}},
+					{Port: 9090, Hostnames: []string{"route3"}},
+				}
+			})
+
+			It("emits one route per port, in port order", func() {
+				routingInfo, err := builder.RoutingInfo(&desiredApp)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(routingInfo).Should(Equal(cfroutes.CFRoutes{
+					{Hostnames: []string{"route1", "route2", "route3"}, Port: 9090},
+					{Port: 9091},
+					{Hostnames: []string{"admin"}, Port: 9092},
+				}.RoutingInfo()))
+			})
+		})
+
+		Context("when hostnames are routed to a port the app does not expose", func() {
+			BeforeEach(func() {
+				desiredApp.PortRoutes = []cc_messages.PortRoutes{
+					{Port: 9092, Hostnames: []string{"admin"}},
+				}
+			})
+
+			It("errors", func() {
+				_, err := builder.RoutingInfo(&desiredApp)
+				Ω(err).Should(MatchError(recipebuilder.ErrRoutePortNotExposed))
+			})
+		})
+	})
+})
@@ -0,0 +1,116 @@
+package recipebuilder
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+)
+
+const (
+	DefaultSSHPort = uint16(2222)
+
+	SSHLogSource = "SSH"
+)
+
+var ErrSSHPortInUse = errors.New("the ssh port is already exposed by the app")
+
+// SSHConfig lets operators ssh into the instances of apps that allow it. An
+// SSH daemon downloaded from the file server runs next to each such app.
+type SSHConfig struct {
+	Enabled bool
+
+	// DaemonPath is the path of the daemon's bundle on the file server.
+	DaemonPath string
+	// Port is the container port the daemon listens on.
+	Port uint16
+
+	// HostKey is the PEM-encoded private key the daemon identifies with.
+	HostKey string
+	// AuthorizedKeys lists the public keys allowed to log in, one per line.
+	AuthorizedKeys string
+}
+
+func (c SSHConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.DaemonPath == "" {
+		return errors.New("ssh requires the path of the daemon bundle")
+	}
+
+	if c.HostKey == "" {
+		return errors.New("ssh requires a host key")
+	}
+
+	if c.AuthorizedKeys == "" {
+		return errors.New("ssh requires authorized keys")
+	}
+
+	return nil
+}
+
+type sshDaemon struct {
+	downloadURL    string
+	port           uint16
+	hostKey        string
+	authorizedKeys string
+}
+
+func newSSHDaemon(config SSHConfig, fileServerURL string) *sshDaemon {
+	if !config.Enabled {
+		return nil
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = DefaultSSHPort
+	}
+
+	return &sshDaemon{
+		downloadURL:    LifecycleDownloadURL(config.DaemonPath, fileServerURL),
+		port:           port,
+		hostKey:        config.HostKey,
+		authorizedKeys: config.AuthorizedKeys,
+	}
+}
+
+// handles is true when both the operator and the app allow ssh.
+func (d *sshDaemon) handles(desiredApp *cc_messages.DesireAppRequestFromCC) bool {
+	return d != nil && desiredApp.AllowSSH
+}
+
+func (d *sshDaemon) setup() models.Action {
+	return &models.DownloadAction{
+		From:     d.downloadURL,
+		To:       "/tmp/ssh",
+		CacheKey: "diego-sshd",
+	}
+}
+
+func (d *sshDaemon) ports(appPorts []uint16) ([]uint16, error) {
+	for _, port := range appPorts {
+		if port == d.port {
+			return nil, ErrSSHPortInUse
+		}
+	}
+
+	return append(append([]uint16{}, appPorts...), d.port), nil
+}
+
+func (d *sshDaemon) action(numFiles uint64) *models.RunAction {
+	return &models.RunAction{
+		Path: "/tmp/ssh/diego-sshd",
+		Args: []string{fmt.Sprintf("-address=0.0.0.0:%d", d.port)},
+		Env: []models.EnvironmentVariable{
+			{Name: "SSHD_HOST_KEY", Value: d.hostKey},
+			{Name: "SSHD_AUTHORIZED_KEYS", Value: d.authorizedKeys},
+		},
+		LogSource: SSHLogSource,
+		ResourceLimits: models.ResourceLimits{
+			Nofile: &numFiles,
+		},
+	}
+}
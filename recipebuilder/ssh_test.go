@@ -0,0 +1,164 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SSH", func() {
+	Describe("SSHConfig", func() {
+		var config recipebuilder.SSHConfig
+
+		BeforeEach(func() {
+			config = recipebuilder.SSHConfig{
+				Enabled:        true,
+				DaemonPath:     "diego-sshd.tgz",
+				HostKey:        "host-key",
+				AuthorizedKeys: "authorized-keys",
+			}
+		})
+
+		It("is valid with a daemon and keys", func() {
+			Ω(config.Validate()).Should(Succeed())
+		})
+
+		It("requires the daemon bundle", func() {
+			config.DaemonPath = ""
+			Ω(config.Validate()).ShouldNot(Succeed())
+		})
+
+		It("requires a host key", func() {
+			config.HostKey = ""
+			Ω(config.Validate()).ShouldNot(Succeed())
+		})
+
+		It("requires authorized keys", func() {
+			config.AuthorizedKeys = ""
+			Ω(config.Validate()).ShouldNot(Succeed())
+		})
+
+		It("requires nothing when disabled", func() {
+			Ω(recipebuilder.SSHConfig{}.Validate()).Should(Succeed())
+		})
+	})
+
+	Describe("building an app", func() {
+		var (
+			sshConfig  recipebuilder.SSHConfig
+			desiredApp cc_messages.DesireAppRequestFromCC
+
+			desiredLRP *receptor.DesiredLRPCreateRequest
+			err        error
+		)
+
+		BeforeEach(func() {
+			sshConfig = recipebuilder.SSHConfig{
+				Enabled:        true,
+				DaemonPath:     "diego-sshd.tgz",
+				HostKey:        "host-key",
+				AuthorizedKeys: "authorized-keys",
+			}
+
+			desiredApp = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:     "the-app-guid",
+				DropletUri:      "http://the-droplet.uri.com",
+				Stack:           "some-stack",
+				MemoryMB:        128,
+				FileDescriptors: 32,
+				NumInstances:    1,
+				AllowSSH:        true,
+			}
+		})
+
+		JustBeforeEach(func() {
+			builder := recipebuilder.New(recipebuilder.Config{
+				Lifecycles:    map[string]string{"some-stack": "some-lifecycle.tgz"},
+				FileServerURL: "http://file-server.com",
+				SSH:           sshConfig,
+			}, lager.NewLogger("fakelogger"))
+
+			desiredLRP, err = builder.Build(&desiredApp)
+		})
+
+		It("downloads the daemon during setup", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desiredLRP.Setup.(*models.SerialAction).Actions).Should(ContainElement(&models.DownloadAction{
+				From:     "http://file-server.com/v1/static/diego-sshd.tgz",
+				To:       "/tmp/ssh",
+				CacheKey: "diego-sshd",
+			}))
+		})
+
+		It("runs the daemon next to the app", func() {
+			codependent := desiredLRP.Action.(*models.CodependentAction)
+			Ω(codependent.Actions).Should(HaveLen(2))
+			Ω(codependent.Actions[0].(*models.RunAction).Path).Should(Equal("/tmp/lifecycle/launcher"))
+
+			nofile := uint64(32)
+			Ω(codependent.Actions[1]).Should(Equal(&models.RunAction{
+				Path: "/tmp/ssh/diego-sshd",
+				Args: []string{"-address=0.0.0.0:2222"},
+				Env: []models.EnvironmentVariable{
+					{Name: "SSHD_HOST_KEY", Value: "host-key"},
+					{Name: "SSHD_AUTHORIZED_KEYS", Value: "authorized-keys"},
+				},
+				LogSource: recipebuilder.SSHLogSource,
+				ResourceLimits: models.ResourceLimits{
+					Nofile: &nofile,
+				},
+			}))
+		})
+
+		It("exposes the ssh port after the app's ports", func() {
+			Ω(desiredLRP.Ports).Should(Equal([]uint16{8080, 2222}))
+		})
+
+		Context("when the operator picks the port", func() {
+			BeforeEach(func() {
+				sshConfig.Port = 2022
+			})
+
+			It("exposes that port", func() {
+				Ω(desiredLRP.Ports).Should(Equal([]uint16{8080, 2022}))
+			})
+		})
+
+		Context("when the app already exposes the ssh port", func() {
+			BeforeEach(func() {
+				desiredApp.Ports = []uint16{8080, 2222}
+			})
+
+			It("errors", func() {
+				Ω(err).Should(Equal(recipebuilder.ErrSSHPortInUse))
+			})
+		})
+
+		Context("when the app does not allow ssh", func() {
+			BeforeEach(func() {
+				desiredApp.AllowSSH = false
+			})
+
+			It("runs only the app", func() {
+				Ω(desiredLRP.Action).Should(BeAssignableToTypeOf(&models.RunAction{}))
+				Ω(desiredLRP.Ports).Should(Equal([]uint16{8080}))
+			})
+		})
+
+		Context("when the operator has not enabled ssh", func() {
+			BeforeEach(func() {
+				sshConfig = recipebuilder.SSHConfig{}
+			})
+
+			It("runs only the app", func() {
+				Ω(desiredLRP.Action).Should(BeAssignableToTypeOf(&models.RunAction{}))
+				Ω(desiredLRP.Ports).Should(Equal([]uint16{8080}))
+			})
+		})
+	})
+})
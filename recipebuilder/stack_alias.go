@@ -0,0 +1,123 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/metric"
+	"github.com/pivotal-golang/lager"
+)
+
+var deprecatedStackCounter = metric.Counter("LRPsDesiredOnDeprecatedStack")
+
+// A StackAlias moves the apps of a retired stack onto its replacement.
+type StackAlias struct {
+	// Stack is the replacement stack.
+	Stack string `json:"stack"`
+	// Lifecycle is the lifecycle bundle for aliased apps; the replacement
+	// stack's bundle is used when it is empty.
+	Lifecycle string `json:"lifecycle,omitempty"`
+	// Cutoff is when apps on the retired stack stop being built; they are
+	// built forever when it is zero.
+	Cutoff time.Time `json:"cutoff,omitempty"`
+}
+
+// StackAliases maps retired stack names to their aliases.
+type StackAliases map[string]StackAlias
+
+type StackRetiredError struct {
+	Stack  string
+	Cutoff time.Time
+}
+
+func (e StackRetiredError) Error() string {
+	return fmt.Sprintf("stack %q was retired at %s", e.Stack, e.Cutoff.Format(time.RFC3339))
+}
+
+// LoadStackAliases reads the aliases and checks that every aliased app can
+// find a lifecycle bundle among its alias and the buildpack lifecycles.
+func LoadStackAliases(path string, lifecycles map[string]string) (StackAliases, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := StackAliases{}
+	err = json.Unmarshal(contents, &aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	for stack, alias := range aliases {
+		if alias.Stack == "" {
+			return nil, fmt.Errorf("stack alias %q has no replacement stack", stack)
+		}
+
+		if _, chained := aliases[alias.Stack]; chained {
+			return nil, fmt.Errorf("stack alias %q points at aliased stack %q", stack, alias.Stack)
+		}
+
+		if _, found := lifecycles[alias.Stack]; alias.Lifecycle == "" && !found {
+			return nil, fmt.Errorf("stack alias %q has no lifecycle and stack %q has none to share", stack, alias.Stack)
+		}
+	}
+
+	return aliases, nil
+}
+
+// Lifecycles adds the bundle of every alias to the buildpack lifecycles, so
+// that apps still desired on a retired stack can find one.
+func (a StackAliases) Lifecycles(lifecycles map[string]string) map[string]string {
+	if len(a) == 0 {
+		return lifecycles
+	}
+
+	merged := map[string]string{}
+	for stack, path := range lifecycles {
+		merged[stack] = path
+	}
+
+	for stack, alias := range a {
+		path := alias.Lifecycle
+		if path == "" {
+			path = lifecycles[alias.Stack]
+		}
+
+		if path != "" {
+			merged[stack] = path
+		}
+	}
+
+	return merged
+}
+
+// resolveStack returns the stack an app's LRP runs on.
+func (b *RecipeBuilder) resolveStack(logger lager.Logger, processGuid, stack string) (string, error) {
+	alias, ok := b.stackAliases[stack]
+	if !ok {
+		return stack, nil
+	}
+
+	data := lager.Data{
+		"process-guid": processGuid,
+		"stack":        stack,
+		"replacement":  alias.Stack,
+	}
+
+	if !alias.Cutoff.IsZero() {
+		data["cutoff"] = alias.Cutoff
+
+		if !b.clock.Now().Before(alias.Cutoff) {
+			err := StackRetiredError{Stack: stack, Cutoff: alias.Cutoff}
+			logger.Error("stack-retired", err, data)
+			return "", err
+		}
+	}
+
+	logger.Info("deprecated-stack", data)
+	deprecatedStackCounter.Increment()
+
+	return alias.Stack, nil
+}
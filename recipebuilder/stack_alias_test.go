@@ -0,0 +1,204 @@
+package recipebuilder_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	"github.com/pivotal-golang/clock/fakeclock"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Stack Aliases", func() {
+	Describe("LoadStackAliases", func() {
+		var (
+			path       string
+			lifecycles map[string]string
+		)
+
+		writeAliases := func(contents string) {
+			err := ioutil.WriteFile(path, []byte(contents), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "stack-aliases")
+			Ω(err).ShouldNot(HaveOccurred())
+			file.Close()
+
+			path = file.Name()
+
+			lifecycles = map[string]string{"new-stack": "new-lifecycle.tgz"}
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("loads the aliases by retired stack", func() {
+			writeAliases(`{
+				"old-stack": {"stack": "new-stack", "lifecycle": "old-lifecycle.tgz", "cutoff": "2015-06-01T00:00:00Z"},
+				"older-stack": {"stack": "new-stack"}
+			}`)
+
+			aliases, err := recipebuilder.LoadStackAliases(path, lifecycles)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(aliases).Should(Equal(recipebuilder.StackAliases{
+				"old-stack": {
+					Stack:     "new-stack",
+					Lifecycle: "old-lifecycle.tgz",
+					Cutoff:    time.Date(2015, time.June, 1, 0, 0, 0, 0, time.UTC),
+				},
+				"older-stack": {Stack: "new-stack"},
+			}))
+		})
+
+		It("rejects aliases without a replacement stack", func() {
+			writeAliases(`{"old-stack": {"lifecycle": "old-lifecycle.tgz"}}`)
+
+			_, err := recipebuilder.LoadStackAliases(path, lifecycles)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects aliases of aliases", func() {
+			writeAliases(`{"older-stack": {"stack": "old-stack"}, "old-stack": {"stack": "new-stack"}}`)
+
+			_, err := recipebuilder.LoadStackAliases(path, lifecycles)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects aliases without a lifecycle whose replacement stack has none", func() {
+			writeAliases(`{"old-stack": {"stack": "unknown-stack"}}`)
+
+			_, err := recipebuilder.LoadStackAliases(path, lifecycles)
+			Ω(err).Should(MatchError(ContainSubstring(`stack alias "old-stack" has no lifecycle`)))
+		})
+
+		It("accepts aliases that bring their own lifecycle to a stack without one", func() {
+			writeAliases(`{"old-stack": {"stack": "unknown-stack", "lifecycle": "old-lifecycle.tgz"}}`)
+
+			_, err := recipebuilder.LoadStackAliases(path, lifecycles)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("rejects malformed json", func() {
+			writeAliases(`{"old-stack"`)
+
+			_, err := recipebuilder.LoadStackAliases(path, lifecycles)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("building an app on an aliased stack", func() {
+		var (
+			logger       *lagertest.TestLogger
+			metricSender *fake.FakeMetricSender
+			fakeClock    *fakeclock.FakeClock
+			cutoff       time.Time
+
+			config     recipebuilder.Config
+			desiredApp cc_messages.DesireAppRequestFromCC
+
+			desiredLRP *receptor.DesiredLRPCreateRequest
+			err        error
+		)
+
+		BeforeEach(func() {
+			logger = lagertest.NewTestLogger("test")
+
+			metricSender = fake.NewFakeMetricSender()
+			metrics.Initialize(metricSender)
+
+			cutoff = time.Date(2015, time.June, 1, 0, 0, 0, 0, time.UTC)
+			fakeClock = fakeclock.NewFakeClock(cutoff.Add(-time.Hour))
+
+			config = recipebuilder.Config{
+				Lifecycles:    map[string]string{"new-stack": "new-lifecycle.tgz"},
+				FileServerURL: "http://file-server.com",
+				StackAliases: recipebuilder.StackAliases{
+					"old-stack": {Stack: "new-stack", Cutoff: cutoff},
+				},
+				Clock: fakeClock,
+			}
+
+			desiredApp = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:  "the-app-guid",
+				DropletUri:   "http://the-droplet.uri.com",
+				Stack:        "old-stack",
+				MemoryMB:     128,
+				NumInstances: 1,
+			}
+		})
+
+		JustBeforeEach(func() {
+			desiredLRP, err = recipebuilder.New(config, logger).Build(&desiredApp)
+		})
+
+		It("runs the app on the replacement stack", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desiredLRP.Stack).Should(Equal("new-stack"))
+		})
+
+		It("uses the replacement stack's lifecycle", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desiredLRP.Setup.(*models.SerialAction).Actions[0]).Should(Equal(&models.DownloadAction{
+				From: "http://file-server.com/v1/static/new-lifecycle.tgz",
+				To:   "/tmp/lifecycle",
+			}))
+		})
+
+		It("logs and counts the deprecation", func() {
+			Ω(logger).Should(gbytes.Say("deprecated-stack"))
+			Ω(metricSender.GetCounter("LRPsDesiredOnDeprecatedStack")).Should(Equal(uint64(1)))
+		})
+
+		Context("when the alias names its own lifecycle", func() {
+			BeforeEach(func() {
+				config.StackAliases = recipebuilder.StackAliases{
+					"old-stack": {Stack: "new-stack", Lifecycle: "old-lifecycle.tgz"},
+				}
+			})
+
+			It("uses the alias's lifecycle", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(desiredLRP.Setup.(*models.SerialAction).Actions[0]).Should(Equal(&models.DownloadAction{
+					From: "http://file-server.com/v1/static/old-lifecycle.tgz",
+					To:   "/tmp/lifecycle",
+				}))
+			})
+		})
+
+		Context("once the cutoff has passed", func() {
+			BeforeEach(func() {
+				fakeClock.Increment(time.Hour)
+			})
+
+			It("refuses to build the app", func() {
+				Ω(err).Should(Equal(recipebuilder.StackRetiredError{Stack: "old-stack", Cutoff: cutoff}))
+				Ω(logger).Should(gbytes.Say("stack-retired"))
+			})
+		})
+
+		Context("when the app is not on an aliased stack", func() {
+			BeforeEach(func() {
+				desiredApp.Stack = "new-stack"
+			})
+
+			It("leaves the stack alone", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(desiredLRP.Stack).Should(Equal("new-stack"))
+				Ω(metricSender.GetCounter("LRPsDesiredOnDeprecatedStack")).Should(BeZero())
+			})
+		})
+	})
+})
@@ -0,0 +1,98 @@
+package recipebuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+)
+
+// A StackProfile customizes the recipes of every app on one stack. Zero
+// values leave the builder's defaults in place.
+type StackProfile struct {
+	// SetupDownloads run after the lifecycle's own setup, e.g. to add a CA
+	// bundle or an APM agent to the container.
+	SetupDownloads []StackDownload `json:"setup_downloads,omitempty"`
+
+	// FileDescriptorLimit applies to apps that do not ask for a limit.
+	FileDescriptorLimit uint64 `json:"file_descriptor_limit,omitempty"`
+
+	ResourceBounds
+
+	// Privileged overrides the lifecycle's choice of container when set.
+	Privileged *bool `json:"privileged,omitempty"`
+}
+
+type StackDownload struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	CacheKey string `json:"cache_key,omitempty"`
+}
+
+// StackProfiles maps stack names to their profiles.
+type StackProfiles map[string]StackProfile
+
+func LoadStackProfiles(path string) (StackProfiles, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := StackProfiles{}
+	err = json.Unmarshal(contents, &profiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for stack, profile := range profiles {
+		err := profile.validate()
+		if err != nil {
+			return nil, fmt.Errorf("stack profile %q: %s", stack, err)
+		}
+	}
+
+	return profiles, nil
+}
+
+func (p StackProfile) validate() error {
+	for i, download := range p.SetupDownloads {
+		if download.From == "" || download.To == "" {
+			return fmt.Errorf("setup download %d requires both from and to", i)
+		}
+	}
+
+	return p.ResourceBounds.validate()
+}
+
+func (p StackProfile) setup() []models.Action {
+	actions := make([]models.Action, len(p.SetupDownloads))
+	for i, download := range p.SetupDownloads {
+		actions[i] = &models.DownloadAction{
+			From:     download.From,
+			To:       download.To,
+			CacheKey: download.CacheKey,
+		}
+	}
+
+	return actions
+}
+
+func (p StackProfile) fileDescriptorLimit(requested uint64) uint64 {
+	switch {
+	case requested != 0:
+		return requested
+	case p.FileDescriptorLimit != 0:
+		return p.FileDescriptorLimit
+	default:
+		return DefaultFileDescriptorLimit
+	}
+}
+
+func (p StackProfile) privileged(lifecycleDefault bool) bool {
+	if p.Privileged == nil {
+		return lifecycleDefault
+	}
+
+	return *p.Privileged
+}
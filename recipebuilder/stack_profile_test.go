@@ -0,0 +1,210 @@
+package recipebuilder_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stack Profiles", func() {
+	Describe("LoadStackProfiles", func() {
+		var path string
+
+		writeProfiles := func(contents string) {
+			err := ioutil.WriteFile(path, []byte(contents), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "stack-profiles")
+			Ω(err).ShouldNot(HaveOccurred())
+			file.Close()
+
+			path = file.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("loads the profiles by stack", func() {
+			writeProfiles(`{
+				"some-stack": {
+					"setup_downloads": [{"from": "http://example.com/ca.tgz", "to": "/etc/ssl/extra", "cache_key": "ca-bundle"}],
+					"file_descriptor_limit": 4096,
+					"min_memory_mb": 64,
+					"max_memory_mb": 2048,
+					"privileged": false
+				}
+			}`)
+
+			profiles, err := recipebuilder.LoadStackProfiles(path)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			unprivileged := false
+			Ω(profiles).Should(Equal(recipebuilder.StackProfiles{
+				"some-stack": {
+					SetupDownloads: []recipebuilder.StackDownload{
+						{From: "http://example.com/ca.tgz", To: "/etc/ssl/extra", CacheKey: "ca-bundle"},
+					},
+					FileDescriptorLimit: 4096,
+					ResourceBounds: recipebuilder.ResourceBounds{
+						MinMemoryMB: 64,
+						MaxMemoryMB: 2048,
+					},
+					Privileged: &unprivileged,
+				},
+			}))
+		})
+
+		It("rejects malformed json", func() {
+			writeProfiles(`{"some-stack"`)
+
+			_, err := recipebuilder.LoadStackProfiles(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects downloads without a destination", func() {
+			writeProfiles(`{"some-stack": {"setup_downloads": [{"from": "http://example.com/ca.tgz"}]}}`)
+
+			_, err := recipebuilder.LoadStackProfiles(path)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects inverted bounds", func() {
+			writeProfiles(`{"some-stack": {"min_disk_mb": 1024, "max_disk_mb": 512}}`)
+
+			_, err := recipebuilder.LoadStackProfiles(path)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("building an app on a stack with a profile", func() {
+		var (
+			profile    recipebuilder.StackProfile
+			desiredApp cc_messages.DesireAppRequestFromCC
+			desiredLRP *receptor.DesiredLRPCreateRequest
+			err        error
+		)
+
+		BeforeEach(func() {
+			profile = recipebuilder.StackProfile{}
+
+			desiredApp = cc_messages.DesireAppRequestFromCC{
+				ProcessGuid:  "the-app-guid",
+				DropletUri:   "http://the-droplet.uri.com",
+				Stack:        "some-stack",
+				MemoryMB:     256,
+				DiskMB:       1024,
+				NumInstances: 1,
+			}
+		})
+
+		JustBeforeEach(func() {
+			desiredLRP, err = recipebuilder.New(recipebuilder.Config{
+				Lifecycles:    map[string]string{"some-stack": "some-lifecycle.tgz"},
+				FileServerURL: "http://file-server.com",
+				StackProfiles: recipebuilder.StackProfiles{"some-stack": profile},
+				PrivilegedPolicy: recipebuilder.PrivilegedPolicy{
+					Mode: recipebuilder.LifecyclePrivilegedMode,
+				},
+			}, lager.NewLogger("fakelogger")).Build(&desiredApp)
+		})
+
+		It("keeps the builder's defaults when the profile is empty", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(desiredLRP.Setup.(*models.SerialAction).Actions).Should(HaveLen(2))
+			Ω(*desiredLRP.Action.(*models.RunAction).ResourceLimits.Nofile).Should(Equal(recipebuilder.DefaultFileDescriptorLimit))
+			Ω(desiredLRP.MemoryMB).Should(Equal(256))
+			Ω(desiredLRP.DiskMB).Should(Equal(1024))
+			Ω(desiredLRP.Privileged).Should(BeTrue())
+		})
+
+		Context("with setup downloads", func() {
+			BeforeEach(func() {
+				profile.SetupDownloads = []recipebuilder.StackDownload{
+					{From: "http://example.com/apm-agent.tgz", To: "/tmp/apm"},
+				}
+			})
+
+			It("runs them after the lifecycle's setup", func() {
+				actions := desiredLRP.Setup.(*models.SerialAction).Actions
+				Ω(actions).Should(HaveLen(3))
+				Ω(actions[2]).Should(Equal(&models.DownloadAction{
+					From: "http://example.com/apm-agent.tgz",
+					To:   "/tmp/apm",
+				}))
+			})
+		})
+
+		Context("with a file descriptor limit", func() {
+			BeforeEach(func() {
+				profile.FileDescriptorLimit = 4096
+			})
+
+			It("applies it to apps that do not ask for a limit", func() {
+				Ω(*desiredLRP.Action.(*models.RunAction).ResourceLimits.Nofile).Should(Equal(uint64(4096)))
+			})
+
+			Context("when the app asks for a limit", func() {
+				BeforeEach(func() {
+					desiredApp.FileDescriptors = 32
+				})
+
+				It("uses the app's limit", func() {
+					Ω(*desiredLRP.Action.(*models.RunAction).ResourceLimits.Nofile).Should(Equal(uint64(32)))
+				})
+			})
+		})
+
+		Context("with resource bounds", func() {
+			BeforeEach(func() {
+				profile.MinMemoryMB = 512
+				profile.MaxDiskMB = 2048
+			})
+
+			It("raises requests below the minimum", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(desiredLRP.MemoryMB).Should(Equal(512))
+				Ω(desiredLRP.DiskMB).Should(Equal(1024))
+			})
+
+			It("reports the raised memory limit to the app", func() {
+				Ω(desiredLRP.Action.(*models.RunAction).Env).Should(ContainElement(models.EnvironmentVariable{
+					Name:  "MEMORY_LIMIT",
+					Value: "512m",
+				}))
+			})
+
+			Context("when the app asks for more than the maximum", func() {
+				BeforeEach(func() {
+					desiredApp.DiskMB = 4096
+				})
+
+				It("rejects the app rather than shrinking its limit", func() {
+					Ω(err).Should(BeAssignableToTypeOf(recipebuilder.ValidationError{}))
+					Ω(err).Should(MatchError(ContainSubstring("disk_mb 4096 exceeds the limit of 2048")))
+				})
+			})
+		})
+
+		Context("when the profile chooses unprivileged containers", func() {
+			BeforeEach(func() {
+				unprivileged := false
+				profile.Privileged = &unprivileged
+			})
+
+			It("overrides the lifecycle", func() {
+				Ω(desiredLRP.Privileged).Should(BeFalse())
+			})
+		})
+	})
+})
@@ -0,0 +1,175 @@
+package recipebuilder
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/route-emitter/cfroutes"
+	"github.com/cloudfoundry-incubator/runtime-schema/models"
+)
+
+var (
+	processGuidPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	envVarNamePattern  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// Cloud Controller accepts underscores in route hosts, so labels may too.
+	hostnameLabel = regexp.MustCompile(`^([a-zA-Z0-9_]|[a-zA-Z0-9_][a-zA-Z0-9_-]{0,61}[a-zA-Z0-9_])$`)
+)
+
+// ValidationError collects every problem found in a desired LRP, so that a
+// bad desire message can be fixed in one go.
+type ValidationError []error
+
+func (ve ValidationError) Error() string {
+	return strings.Join(ve.Messages(), "; ")
+}
+
+func (ve ValidationError) Messages() []string {
+	messages := make([]string, len(ve))
+	for i, err := range ve {
+		messages[i] = err.Error()
+	}
+
+	return messages
+}
+
+func (b *RecipeBuilder) validate(desiredLRP *receptor.DesiredLRPCreateRequest) error {
+	var validationErr ValidationError
+
+	if !processGuidPattern.MatchString(desiredLRP.ProcessGuid) {
+		validationErr = append(validationErr, fmt.Errorf("process_guid %q may only contain letters, digits, '-' and '_'", desiredLRP.ProcessGuid))
+	}
+
+	if desiredLRP.MemoryMB < 0 {
+		validationErr = append(validationErr, fmt.Errorf("memory_mb %d must not be negative", desiredLRP.MemoryMB))
+	}
+
+	if desiredLRP.DiskMB < 0 {
+		validationErr = append(validationErr, fmt.Errorf("disk_mb %d must not be negative", desiredLRP.DiskMB))
+	}
+
+	validationErr = append(validationErr, b.stackProfiles[desiredLRP.Stack].errors(desiredLRP.MemoryMB, desiredLRP.DiskMB)...)
+	validationErr = append(validationErr, b.resourcePolicy.errors(desiredLRP.MemoryMB, desiredLRP.DiskMB)...)
+
+	if desiredLRP.Instances < 0 {
+		validationErr = append(validationErr, fmt.Errorf("num_instances %d must not be negative", desiredLRP.Instances))
+	} else if err := b.resourcePolicy.instancesError(desiredLRP.Instances); err != nil {
+		validationErr = append(validationErr, err)
+	}
+
+	if err := validateRootFSPath(desiredLRP.RootFSPath); err != nil {
+		validationErr = append(validationErr, err)
+	}
+
+	validationErr = append(validationErr, routeErrors(desiredLRP.Routes)...)
+
+	for _, run := range runActions(desiredLRP.Action) {
+		for _, env := range run.Env {
+			if !envVarNamePattern.MatchString(env.Name) {
+				validationErr = append(validationErr, fmt.Errorf("environment variable name %q is invalid", env.Name))
+			}
+		}
+	}
+
+	if len(validationErr) > 0 {
+		return validationErr
+	}
+
+	return nil
+}
+
+// routeErrors checks the hostnames of the routes, for creates and updates
+// alike.
+func routeErrors(routingInfo receptor.RoutingInfo) []error {
+	errs := []error{}
+
+	routes, err := cfroutes.CFRoutesFromRoutingInfo(routingInfo)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("routes are malformed: %s", err))
+	}
+
+	for _, route := range routes {
+		for _, hostname := range route.Hostnames {
+			if !validHostname(hostname) {
+				errs = append(errs, fmt.Errorf("route %q is not a valid hostname", hostname))
+			}
+		}
+	}
+
+	return errs
+}
+
+// runActions finds the run actions nested anywhere in an action, such as the
+// app's process when it runs codependently with the ssh daemon.
+func runActions(action models.Action) []*models.RunAction {
+	switch a := action.(type) {
+	case *models.RunAction:
+		return []*models.RunAction{a}
+	case *models.TimeoutAction:
+		return runActions(a.Action)
+	case *models.TryAction:
+		return runActions(a.Action)
+	case *models.EmitProgressAction:
+		return runActions(a.Action)
+	case *models.SerialAction:
+		return nestedRunActions(a.Actions)
+	case *models.ParallelAction:
+		return nestedRunActions(a.Actions)
+	case *models.CodependentAction:
+		return nestedRunActions(a.Actions)
+	}
+
+	return nil
+}
+
+func nestedRunActions(actions []models.Action) []*models.RunAction {
+	runs := []*models.RunAction{}
+	for _, action := range actions {
+		runs = append(runs, runActions(action)...)
+	}
+
+	return runs
+}
+
+func validateRootFSPath(rootFSPath string) error {
+	if rootFSPath == "" {
+		return nil
+	}
+
+	rootFSURL, err := url.Parse(rootFSPath)
+	if err != nil {
+		return fmt.Errorf("rootfs %q is not a valid url: %s", rootFSPath, err)
+	}
+
+	if rootFSURL.Scheme == "" {
+		return fmt.Errorf("rootfs %q has no scheme", rootFSPath)
+	}
+
+	if rootFSURL.Scheme == DockerScheme && strings.Trim(rootFSURL.Path, "/") == "" {
+		return errors.New("docker rootfs has no repository")
+	}
+
+	return nil
+}
+
+func validHostname(hostname string) bool {
+	if len(hostname) == 0 || len(hostname) > 253 {
+		return false
+	}
+
+	for i, label := range strings.Split(hostname, ".") {
+		if i == 0 && label == "*" {
+			continue
+		}
+
+		if !hostnameLabel.MatchString(label) {
+			return false
+		}
+	}
+
+	return true
+}
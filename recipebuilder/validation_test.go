@@ -0,0 +1,145 @@
+package recipebuilder_test
+
+import (
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/cc_messages"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Validation", func() {
+	var (
+		config        recipebuilder.Config
+		desiredAppReq cc_messages.DesireAppRequestFromCC
+		desiredLRP    *receptor.DesiredLRPCreateRequest
+		err           error
+	)
+
+	BeforeEach(func() {
+		config = recipebuilder.Config{
+			Lifecycles: map[string]string{
+				"some-stack": "some-lifecycle.tgz",
+			},
+			DockerLifecyclePath: "the/docker/lifecycle/path.tgz",
+			FileServerURL:       "http://file-server.com",
+		}
+
+		desiredAppReq = cc_messages.DesireAppRequestFromCC{
+			ProcessGuid:  "the-app-guid-the-app-version",
+			DropletUri:   "http://the-droplet.uri.com",
+			Stack:        "some-stack",
+			StartCommand: "the-start-command",
+			Environment: cc_messages.Environment{
+				{Name: "foo", Value: "bar"},
+			},
+			MemoryMB:     128,
+			DiskMB:       512,
+			NumInstances: 23,
+			Routes:       []string{"route1.example.com", "*.example.com"},
+		}
+	})
+
+	JustBeforeEach(func() {
+		builder := recipebuilder.New(config, lager.NewLogger("fakelogger"))
+		desiredLRP, err = builder.Build(&desiredAppReq)
+	})
+
+	It("accepts a valid desired app", func() {
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(desiredLRP).ShouldNot(BeNil())
+	})
+
+	Context("when the desired app has several problems", func() {
+		BeforeEach(func() {
+			desiredAppReq.ProcessGuid = "the app guid"
+			desiredAppReq.Routes = []string{"-bad-.example.com", "good.example.com", "bad..example.com"}
+			desiredAppReq.Environment = cc_messages.Environment{
+				{Name: "1FOO", Value: "bar"},
+				{Name: "GOOD", Value: "bar"},
+			}
+			desiredAppReq.MemoryMB = -1
+			desiredAppReq.DiskMB = -2
+		})
+
+		It("reports all of them at once", func() {
+			validationErr, ok := err.(recipebuilder.ValidationError)
+			Ω(ok).Should(BeTrue())
+
+			Ω(validationErr).Should(HaveLen(6))
+			Ω(validationErr.Error()).Should(ContainSubstring(`process_guid "the app guid"`))
+			Ω(validationErr.Error()).Should(ContainSubstring(`route "-bad-.example.com"`))
+			Ω(validationErr.Error()).Should(ContainSubstring(`route "bad..example.com"`))
+			Ω(validationErr.Error()).Should(ContainSubstring(`environment variable name "1FOO"`))
+			Ω(validationErr.Error()).Should(ContainSubstring("memory_mb -1"))
+			Ω(validationErr.Error()).Should(ContainSubstring("disk_mb -2"))
+		})
+
+		It("does not build a desired LRP", func() {
+			Ω(desiredLRP).Should(BeNil())
+		})
+	})
+
+	Context("when the app runs next to an ssh daemon", func() {
+		BeforeEach(func() {
+			config.SSH = recipebuilder.SSHConfig{
+				Enabled:        true,
+				DaemonPath:     "diego-sshd.tgz",
+				HostKey:        "host-key",
+				AuthorizedKeys: "authorized-keys",
+			}
+
+			desiredAppReq.AllowSSH = true
+			desiredAppReq.Environment = cc_messages.Environment{
+				{Name: "1FOO", Value: "bar"},
+			}
+		})
+
+		It("still validates the app's environment", func() {
+			Ω(err).Should(MatchError(ContainSubstring(`environment variable name "1FOO" is invalid`)))
+			Ω(desiredLRP).Should(BeNil())
+		})
+	})
+
+	Context("when a route host contains underscores", func() {
+		BeforeEach(func() {
+			desiredAppReq.Routes = []string{"my_app.example.com", "_internal.example.com"}
+		})
+
+		It("accepts it", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when the number of instances is negative", func() {
+		BeforeEach(func() {
+			desiredAppReq.NumInstances = -1
+		})
+
+		It("errors", func() {
+			Ω(err).Should(MatchError(ContainSubstring("num_instances -1 must not be negative")))
+		})
+	})
+
+	Context("when the builder limits the number of instances", func() {
+		BeforeEach(func() {
+			config.ResourcePolicy.MaxInstances = 10
+		})
+
+		It("rejects apps over the limit", func() {
+			Ω(err).Should(MatchError(ContainSubstring("num_instances 23 exceeds the limit of 10")))
+		})
+
+		Context("and the app is within the limit", func() {
+			BeforeEach(func() {
+				desiredAppReq.NumInstances = 10
+			})
+
+			It("accepts it", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,330 @@
+// Package recipeflags defines the recipe builder flags shared by every nsync
+// command, so that they all build the same recipes from the same settings.
+package recipeflags
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+)
+
+// An InvalidFlagError names the flag whose value could not be used.
+type InvalidFlagError struct {
+	Flag string
+	Err  error
+}
+
+func (e InvalidFlagError) Error() string {
+	return fmt.Sprintf("invalid -%s: %s", e.Flag, e.Err)
+}
+
+type Flags struct {
+	lifecycles          *string
+	dockerLifecyclePath *string
+	fileServerURL       *string
+	enabledLifecycles   *string
+
+	dockerPortRule      *string
+	dockerRegistryRules *string
+
+	maxInstances   *int
+	resourcePolicy *string
+
+	platformEnvFile    *string
+	envPrecedence      *string
+	stackProfiles      *string
+	stackAliases       *string
+	defaultEgressRules *string
+
+	allowSSH              *bool
+	sshDaemonPath         *string
+	sshPort               *int
+	sshHostKeyFile        *string
+	sshAuthorizedKeysFile *string
+
+	privilegedMode         *string
+	privilegedStacks       *string
+	privilegedProcessGuids *string
+
+	healthCheckTimeout      *time.Duration
+	healthCheckProbeTimeout *time.Duration
+	healthCheckInterval     *time.Duration
+}
+
+func AddFlags(flags *flag.FlagSet) *Flags {
+	return &Flags{
+		lifecycles: flags.String(
+			"lifecycles",
+			"",
+			"app lifecycle binary bundle mapping (stack => bundle filename in fileserver)",
+		),
+		dockerLifecyclePath: flags.String(
+			"dockerLifecyclePath",
+			"",
+			"path for downloading docker lifecycle from file server",
+		),
+		fileServerURL: flags.String(
+			"fileServerURL",
+			"",
+			"URL of the file server",
+		),
+		enabledLifecycles: flags.String(
+			"enabledLifecycles",
+			"buildpack,docker",
+			"comma-separated list of app lifecycles to run (buildpack, docker)",
+		),
+
+		dockerPortRule: flags.String(
+			"dockerPortRule",
+			string(recipebuilder.DefaultDockerPortRule),
+			"how to choose among the tcp ports a docker image exposes (first, lowest or single)",
+		),
+		dockerRegistryRules: flags.String(
+			"dockerRegistryRules",
+			"",
+			"ordered docker registry rules, as a JSON list of {registry, mirror} or {registry, deny} objects",
+		),
+
+		maxInstances: flags.Int(
+			"maxInstances",
+			0,
+			"maximum number of instances of a single app (0 for no limit); overrides the resource policy's cap",
+		),
+		resourcePolicy: flags.String(
+			"resourcePolicy",
+			"",
+			"path to a JSON resource policy for memory, disk, instances and CPU weight",
+		),
+
+		platformEnvFile: flags.String(
+			"platformEnvFile",
+			"",
+			"path to a JSON object of environment variables to inject into every app",
+		),
+		envPrecedence: flags.String(
+			"envPrecedence",
+			string(recipebuilder.DefaultEnvPrecedence),
+			"whether app or platform environment variables win when both set the same name (app or platform)",
+		),
+		stackProfiles: flags.String(
+			"stackProfiles",
+			"",
+			"path to a JSON object of per-stack recipe profiles",
+		),
+		stackAliases: flags.String(
+			"stackAliases",
+			"",
+			"path to a JSON object mapping retired stacks to their replacements",
+		),
+		defaultEgressRules: flags.String(
+			"defaultEgressRules",
+			"",
+			"path to a JSON list of egress rules to add to every app",
+		),
+
+		allowSSH: flags.Bool(
+			"allowSSH",
+			false,
+			"run an SSH daemon next to apps that allow ssh",
+		),
+		sshDaemonPath: flags.String(
+			"sshDaemonPath",
+			"",
+			"path to the SSH daemon bundle on the file server",
+		),
+		sshPort: flags.Int(
+			"sshPort",
+			int(recipebuilder.DefaultSSHPort),
+			"container port the SSH daemon listens on",
+		),
+		sshHostKeyFile: flags.String(
+			"sshHostKeyFile",
+			"",
+			"path to the PEM-encoded host key of the SSH daemon",
+		),
+		sshAuthorizedKeysFile: flags.String(
+			"sshAuthorizedKeysFile",
+			"",
+			"path to the public keys allowed to ssh into apps",
+		),
+
+		privilegedMode: flags.String(
+			"privilegedMode",
+			string(recipebuilder.DefaultPrivilegedMode),
+			"which apps may run in privileged containers (unprivileged: only allowlisted apps; lifecycle: as the lifecycle requests)",
+		),
+		privilegedStacks: flags.String(
+			"privilegedStacks",
+			"",
+			"comma-separated list of stacks whose apps may run in privileged containers",
+		),
+		privilegedProcessGuids: flags.String(
+			"privilegedProcessGuids",
+			"",
+			"comma-separated list of process guids that may run in privileged containers",
+		),
+
+		healthCheckTimeout: flags.Duration(
+			"healthCheckTimeout",
+			recipebuilder.DefaultHealthCheckTimeout,
+			"maximum duration of a single run of an app's health check",
+		),
+		healthCheckProbeTimeout: flags.Duration(
+			"healthCheckProbeTimeout",
+			recipebuilder.DefaultHealthCheckProbeTimeout,
+			"timeout for each request made by an http health check",
+		),
+		healthCheckInterval: flags.Duration(
+			"healthCheckInterval",
+			recipebuilder.DefaultHealthCheckInterval,
+			"wait between requests made by an http health check",
+		),
+	}
+}
+
+// Config parses the flags and loads the files they point at.
+func (f *Flags) Config() (recipebuilder.Config, error) {
+	config := recipebuilder.Config{
+		DockerLifecyclePath:     *f.dockerLifecyclePath,
+		FileServerURL:           *f.fileServerURL,
+		HealthCheckTimeout:      *f.healthCheckTimeout,
+		HealthCheckProbeTimeout: *f.healthCheckProbeTimeout,
+		HealthCheckInterval:     *f.healthCheckInterval,
+	}
+
+	err := json.Unmarshal([]byte(*f.lifecycles), &config.Lifecycles)
+	if err != nil {
+		return config, InvalidFlagError{"lifecycles", err}
+	}
+
+	config.EnabledLifecycles, err = recipebuilder.ParseEnabledLifecycles(*f.enabledLifecycles)
+	if err != nil {
+		return config, InvalidFlagError{"enabledLifecycles", err}
+	}
+
+	if config.DockerLifecyclePath == "" && config.LifecycleEnabled(recipebuilder.DockerLifecycleName) {
+		return config, InvalidFlagError{"dockerLifecyclePath", errors.New("required when the docker lifecycle is enabled")}
+	}
+
+	config.DockerPortRule, err = recipebuilder.ParseDockerPortRule(*f.dockerPortRule)
+	if err != nil {
+		return config, InvalidFlagError{"dockerPortRule", err}
+	}
+
+	config.DockerRegistryRules, err = recipebuilder.ParseDockerRegistryRules(*f.dockerRegistryRules)
+	if err != nil {
+		return config, InvalidFlagError{"dockerRegistryRules", err}
+	}
+
+	config.EnvPrecedence, err = recipebuilder.ParseEnvPrecedence(*f.envPrecedence)
+	if err != nil {
+		return config, InvalidFlagError{"envPrecedence", err}
+	}
+
+	if *f.platformEnvFile != "" {
+		config.PlatformEnv, err = recipebuilder.LoadPlatformEnv(*f.platformEnvFile)
+		if err != nil {
+			return config, InvalidFlagError{"platformEnvFile", err}
+		}
+	}
+
+	if *f.defaultEgressRules != "" {
+		config.DefaultEgressRules, err = recipebuilder.LoadDefaultEgressRules(*f.defaultEgressRules)
+		if err != nil {
+			return config, InvalidFlagError{"defaultEgressRules", err}
+		}
+	}
+
+	config.PrivilegedPolicy.Mode, err = recipebuilder.ParsePrivilegedMode(*f.privilegedMode)
+	if err != nil {
+		return config, InvalidFlagError{"privilegedMode", err}
+	}
+	config.PrivilegedPolicy.Stacks = splitList(*f.privilegedStacks)
+	config.PrivilegedPolicy.ProcessGuids = splitList(*f.privilegedProcessGuids)
+
+	if *f.stackProfiles != "" {
+		config.StackProfiles, err = recipebuilder.LoadStackProfiles(*f.stackProfiles)
+		if err != nil {
+			return config, InvalidFlagError{"stackProfiles", err}
+		}
+	}
+
+	if *f.stackAliases != "" {
+		config.StackAliases, err = recipebuilder.LoadStackAliases(*f.stackAliases, config.Lifecycles)
+		if err != nil {
+			return config, InvalidFlagError{"stackAliases", err}
+		}
+	}
+
+	if *f.resourcePolicy != "" {
+		config.ResourcePolicy, err = recipebuilder.LoadResourcePolicy(*f.resourcePolicy)
+		if err != nil {
+			return config, InvalidFlagError{"resourcePolicy", err}
+		}
+	}
+
+	if *f.maxInstances != 0 {
+		config.ResourcePolicy.MaxInstances = *f.maxInstances
+	}
+
+	config.SSH, err = f.sshConfig()
+	if err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+func (f *Flags) sshConfig() (recipebuilder.SSHConfig, error) {
+	config := recipebuilder.SSHConfig{
+		Enabled:    *f.allowSSH,
+		DaemonPath: *f.sshDaemonPath,
+		Port:       uint16(*f.sshPort),
+	}
+
+	if !config.Enabled {
+		return config, nil
+	}
+
+	if *f.sshPort < 1 || *f.sshPort > 65535 {
+		return config, InvalidFlagError{"sshPort", fmt.Errorf("ssh port %d is out of range", *f.sshPort)}
+	}
+
+	hostKey, err := ioutil.ReadFile(*f.sshHostKeyFile)
+	if err != nil {
+		return config, InvalidFlagError{"sshHostKeyFile", err}
+	}
+
+	authorizedKeys, err := ioutil.ReadFile(*f.sshAuthorizedKeysFile)
+	if err != nil {
+		return config, InvalidFlagError{"sshAuthorizedKeysFile", err}
+	}
+
+	config.HostKey = string(hostKey)
+	config.AuthorizedKeys = string(authorizedKeys)
+
+	err = config.Validate()
+	if err != nil {
+		return config, InvalidFlagError{"allowSSH", err}
+	}
+
+	return config, nil
+}
+
+func splitList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,109 @@
+package recipeflags_test
+
+import (
+	"flag"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/nsync/recipeflags"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Flags", func() {
+	var (
+		args []string
+
+		config recipebuilder.Config
+		err    error
+	)
+
+	BeforeEach(func() {
+		args = []string{
+			"-lifecycles", `{"some-stack": "some-lifecycle.tgz"}`,
+			"-dockerLifecyclePath", "the/docker/lifecycle/path.tgz",
+			"-fileServerURL", "http://file-server.com",
+		}
+	})
+
+	JustBeforeEach(func() {
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		recipeFlags := recipeflags.AddFlags(flagSet)
+		Ω(flagSet.Parse(args)).Should(Succeed())
+
+		config, err = recipeFlags.Config()
+	})
+
+	It("builds the recipe builder config from the flags", func() {
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(config.Lifecycles).Should(Equal(map[string]string{"some-stack": "some-lifecycle.tgz"}))
+		Ω(config.DockerLifecyclePath).Should(Equal("the/docker/lifecycle/path.tgz"))
+		Ω(config.FileServerURL).Should(Equal("http://file-server.com"))
+		Ω(config.EnabledLifecycles).Should(ConsistOf("buildpack", "docker"))
+		Ω(config.HealthCheckTimeout).Should(Equal(recipebuilder.DefaultHealthCheckTimeout))
+		Ω(config.PrivilegedPolicy.Mode).Should(Equal(recipebuilder.DefaultPrivilegedMode))
+		Ω(config.SSH.Enabled).Should(BeFalse())
+	})
+
+	Context("when settings are overridden", func() {
+		BeforeEach(func() {
+			args = append(args,
+				"-healthCheckTimeout", "45s",
+				"-maxInstances", "10",
+				"-privilegedStacks", "stack-a, stack-b",
+			)
+		})
+
+		It("uses them", func() {
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(config.HealthCheckTimeout).Should(Equal(45 * time.Second))
+			Ω(config.ResourcePolicy.MaxInstances).Should(Equal(10))
+			Ω(config.PrivilegedPolicy.Stacks).Should(Equal([]string{"stack-a", "stack-b"}))
+		})
+	})
+
+	Context("when the docker lifecycle is enabled without a path", func() {
+		BeforeEach(func() {
+			args = []string{"-lifecycles", `{}`}
+		})
+
+		It("names the missing flag", func() {
+			flagErr, ok := err.(recipeflags.InvalidFlagError)
+			Ω(ok).Should(BeTrue())
+			Ω(flagErr.Flag).Should(Equal("dockerLifecyclePath"))
+		})
+
+		Context("and only the buildpack lifecycle is enabled", func() {
+			BeforeEach(func() {
+				args = append(args, "-enabledLifecycles", "buildpack")
+			})
+
+			It("does not need one", func() {
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when a file the flags point at cannot be read", func() {
+		BeforeEach(func() {
+			args = append(args, "-stackProfiles", "/does/not/exist.json")
+		})
+
+		It("names the flag", func() {
+			Ω(err).Should(MatchError(ContainSubstring("invalid -stackProfiles")))
+		})
+	})
+
+	Context("when ssh is enabled without its keys", func() {
+		BeforeEach(func() {
+			args = append(args, "-allowSSH", "-sshDaemonPath", "diego-sshd.tgz")
+		})
+
+		It("errors", func() {
+			Ω(err).Should(MatchError(ContainSubstring("invalid -sshHostKeyFile")))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package recipeflags_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRecipeflags(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Recipeflags Suite")
+}
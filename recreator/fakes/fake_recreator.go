@@ -0,0 +1,57 @@
+// This file was generated by counterfeiter
+package fakes
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/nsync/recreator"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeRecreator struct {
+	RecreateStub        func(logger lager.Logger, desiredLRP *receptor.DesiredLRPCreateRequest) error
+	recreateMutex       sync.RWMutex
+	recreateArgsForCall []struct {
+		logger     lager.Logger
+		desiredLRP *receptor.DesiredLRPCreateRequest
+	}
+	recreateReturns struct {
+		result1 error
+	}
+}
+
+func (fake *FakeRecreator) Recreate(logger lager.Logger, desiredLRP *receptor.DesiredLRPCreateRequest) error {
+	fake.recreateMutex.Lock()
+	fake.recreateArgsForCall = append(fake.recreateArgsForCall, struct {
+		logger     lager.Logger
+		desiredLRP *receptor.DesiredLRPCreateRequest
+	}{logger, desiredLRP})
+	fake.recreateMutex.Unlock()
+	if fake.RecreateStub != nil {
+		return fake.RecreateStub(logger, desiredLRP)
+	} else {
+		return fake.recreateReturns.result1
+	}
+}
+
+func (fake *FakeRecreator) RecreateCallCount() int {
+	fake.recreateMutex.RLock()
+	defer fake.recreateMutex.RUnlock()
+	return len(fake.recreateArgsForCall)
+}
+
+func (fake *FakeRecreator) RecreateArgsForCall(i int) (lager.Logger, *receptor.DesiredLRPCreateRequest) {
+	fake.recreateMutex.RLock()
+	defer fake.recreateMutex.RUnlock()
+	return fake.recreateArgsForCall[i].logger, fake.recreateArgsForCall[i].desiredLRP
+}
+
+func (fake *FakeRecreator) RecreateReturns(result1 error) {
+	fake.RecreateStub = nil
+	fake.recreateReturns = struct {
+		result1 error
+	}{result1}
+}
+
+var _ recreator.Recreator = new(FakeRecreator)
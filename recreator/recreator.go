@@ -0,0 +1,216 @@
+package recreator
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/recipebuilder"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/runtime-schema/metric"
+	"github.com/pivotal-golang/clock"
+	"github.com/pivotal-golang/lager"
+)
+
+const (
+	DefaultMaxInFlight = 5
+	DefaultInterval    = time.Second
+
+	// maxAttempts bounds how often a recreation starts over after losing a
+	// race with another recreation of the same LRP.
+	maxAttempts = 3
+
+	retirePollInterval = time.Second
+	retireTimeout      = time.Minute
+
+	recreatedLRPCounter = metric.Counter("LRPsRecreated")
+)
+
+var ErrRecreateContended = errors.New("gave up recreating the LRP after repeatedly racing another recreation")
+
+//go:generate counterfeiter -o fakes/fake_recreator.go . Recreator
+
+// A Recreator replaces desired LRPs whose changes the receptor cannot apply
+// in place.
+//
+// Replacing an LRP causes downtime: every instance of the app stops when the
+// LRP is deleted, and none start again until the old instances are retired
+// and the new LRP is placed. Recreations are therefore spread out over time
+// and only a few run at once. These limits apply per process, so the listener
+// and the bulker each get their own; recreations of the same LRP are instead
+// coordinated through the receptor, and a recreation that finds the LRP
+// already recreated stops there.
+type Recreator interface {
+	Recreate(logger lager.Logger, desiredLRP *receptor.DesiredLRPCreateRequest) error
+}
+
+type recreator struct {
+	receptorClient receptor.Client
+	interval       time.Duration
+	clock          clock.Clock
+
+	inFlight chan struct{}
+
+	lock      sync.Mutex
+	nextStart time.Time
+
+	// active holds a channel for each process guid being recreated, closed
+	// once its recreation finishes.
+	active map[string]chan struct{}
+}
+
+// New returns a Recreator that runs at most maxInFlight recreations at once
+// and starts at most one per interval.
+func New(receptorClient receptor.Client, maxInFlight int, interval time.Duration, clock clock.Clock) Recreator {
+	if maxInFlight < 1 {
+		maxInFlight = 1
+	}
+
+	return &recreator{
+		receptorClient: receptorClient,
+		interval:       interval,
+		clock:          clock,
+		inFlight:       make(chan struct{}, maxInFlight),
+		active:         map[string]chan struct{}{},
+	}
+}
+
+func (r *recreator) Recreate(logger lager.Logger, desiredLRP *receptor.DesiredLRPCreateRequest) error {
+	logger = logger.Session("recreate", lager.Data{"process-guid": desiredLRP.ProcessGuid})
+
+	release := r.claim(desiredLRP.ProcessGuid)
+	defer release()
+
+	r.inFlight <- struct{}{}
+	defer func() { <-r.inFlight }()
+
+	r.throttle()
+
+	logger.Info("starting")
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		recreated, err := r.alreadyRecreated(desiredLRP)
+		if err != nil {
+			logger.Error("failed-to-get", err)
+			return err
+		}
+
+		if recreated {
+			logger.Info("already-recreated")
+			return nil
+		}
+
+		err = r.receptorClient.DeleteDesiredLRP(desiredLRP.ProcessGuid)
+		if err != nil && !isType(err, receptor.DesiredLRPNotFound) {
+			logger.Error("failed-to-delete", err)
+			return err
+		}
+
+		r.waitForRetirement(logger, desiredLRP.ProcessGuid)
+
+		err = r.receptorClient.CreateDesiredLRP(*desiredLRP)
+		if isType(err, receptor.DesiredLRPAlreadyExists) {
+			// another recreation got there first; check what it created
+			logger.Info("lost-race-to-create", lager.Data{"attempt": attempt})
+			continue
+		}
+
+		if err != nil {
+			logger.Error("failed-to-create", err)
+			return err
+		}
+
+		recreatedLRPCounter.Increment()
+		logger.Info("finished")
+
+		return nil
+	}
+
+	logger.Error("failed-to-recreate", ErrRecreateContended)
+	return ErrRecreateContended
+}
+
+// claim waits for any other recreation of the process guid in this process
+// to finish, and returns the function that ends this one.
+func (r *recreator) claim(processGuid string) func() {
+	for {
+		r.lock.Lock()
+		busy, found := r.active[processGuid]
+		if !found {
+			done := make(chan struct{})
+			r.active[processGuid] = done
+			r.lock.Unlock()
+
+			return func() {
+				r.lock.Lock()
+				delete(r.active, processGuid)
+				r.lock.Unlock()
+				close(done)
+			}
+		}
+		r.lock.Unlock()
+
+		<-busy
+	}
+}
+
+// alreadyRecreated is true when the existing LRP is the one we would create,
+// e.g. because the listener and the bulker both set out to recreate it.
+func (r *recreator) alreadyRecreated(desiredLRP *receptor.DesiredLRPCreateRequest) (bool, error) {
+	existing, err := r.receptorClient.GetDesiredLRP(desiredLRP.ProcessGuid)
+	if isType(err, receptor.DesiredLRPNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return existing.Annotation == desiredLRP.Annotation &&
+		len(recipebuilder.NonUpdatableChanges(existing, desiredLRP)) == 0, nil
+}
+
+// waitForRetirement gives the cells time to stop the deleted LRP's instances,
+// so that the new LRP does not inherit them. It creates the LRP anyway after
+// retireTimeout, since the app is down until it does.
+func (r *recreator) waitForRetirement(logger lager.Logger, processGuid string) {
+	deadline := r.clock.Now().Add(retireTimeout)
+
+	for {
+		actualLRPs, err := r.receptorClient.ActualLRPsByProcessGuid(processGuid)
+		if err == nil && len(actualLRPs) == 0 {
+			return
+		}
+
+		if !r.clock.Now().Before(deadline) {
+			logger.Info("instances-not-retired", lager.Data{"remaining": len(actualLRPs)})
+			return
+		}
+
+		r.clock.Sleep(retirePollInterval)
+	}
+}
+
+// throttle reserves the next free start time and waits for it.
+func (r *recreator) throttle() {
+	r.lock.Lock()
+	now := r.clock.Now()
+	start := r.nextStart
+	if start.Before(now) {
+		start = now
+	}
+	r.nextStart = start.Add(r.interval)
+	r.lock.Unlock()
+
+	wait := start.Sub(now)
+	if wait <= 0 {
+		return
+	}
+
+	<-r.clock.NewTimer(wait).C()
+}
+
+func isType(err error, errorType string) bool {
+	rerr, ok := err.(receptor.Error)
+	return ok && rerr.Type == errorType
+}
@@ -0,0 +1,13 @@
+package recreator_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestRecreator(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Recreator Suite")
+}
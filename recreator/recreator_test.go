@@ -0,0 +1,278 @@
+package recreator_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry-incubator/nsync/recreator"
+	"github.com/cloudfoundry-incubator/receptor"
+	"github.com/cloudfoundry-incubator/receptor/fake_receptor"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	"github.com/cloudfoundry/dropsonde/metrics"
+	"github.com/pivotal-golang/clock/fakeclock"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recreator", func() {
+	var (
+		receptorClient *fake_receptor.FakeClient
+		clock          *fakeclock.FakeClock
+		logger         *lagertest.TestLogger
+		metricSender   *fake.FakeMetricSender
+
+		maxInFlight int
+		interval    time.Duration
+
+		subject recreator.Recreator
+	)
+
+	desiredLRP := func(processGuid string) *receptor.DesiredLRPCreateRequest {
+		return &receptor.DesiredLRPCreateRequest{ProcessGuid: processGuid, MemoryMB: 256}
+	}
+
+	BeforeEach(func() {
+		receptorClient = new(fake_receptor.FakeClient)
+		clock = fakeclock.NewFakeClock(time.Now())
+		logger = lagertest.NewTestLogger("test")
+
+		metricSender = fake.NewFakeMetricSender()
+		metrics.Initialize(metricSender)
+
+		maxInFlight = 2
+		interval = 0
+
+		receptorClient.GetDesiredLRPStub = func(processGuid string) (receptor.DesiredLRPResponse, error) {
+			return receptor.DesiredLRPResponse{ProcessGuid: processGuid, MemoryMB: 128}, nil
+		}
+	})
+
+	JustBeforeEach(func() {
+		subject = recreator.New(receptorClient, maxInFlight, interval, clock)
+	})
+
+	It("deletes the LRP and creates it again", func() {
+		err := subject.Recreate(logger, desiredLRP("some-guid"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(receptorClient.DeleteDesiredLRPCallCount()).Should(Equal(1))
+		Ω(receptorClient.DeleteDesiredLRPArgsForCall(0)).Should(Equal("some-guid"))
+
+		Ω(receptorClient.CreateDesiredLRPCallCount()).Should(Equal(1))
+		Ω(receptorClient.CreateDesiredLRPArgsForCall(0)).Should(Equal(*desiredLRP("some-guid")))
+	})
+
+	It("counts the recreated LRP", func() {
+		err := subject.Recreate(logger, desiredLRP("some-guid"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(metricSender.GetCounter("LRPsRecreated")).Should(Equal(uint64(1)))
+	})
+
+	Context("when the LRP was already recreated, e.g. by the bulker", func() {
+		BeforeEach(func() {
+			receptorClient.GetDesiredLRPStub = func(processGuid string) (receptor.DesiredLRPResponse, error) {
+				return receptor.DesiredLRPResponse{ProcessGuid: processGuid, MemoryMB: 256}, nil
+			}
+		})
+
+		It("leaves it alone", func() {
+			err := subject.Recreate(logger, desiredLRP("some-guid"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(receptorClient.DeleteDesiredLRPCallCount()).Should(Equal(0))
+			Ω(receptorClient.CreateDesiredLRPCallCount()).Should(Equal(0))
+		})
+	})
+
+	Context("when getting the LRP fails", func() {
+		BeforeEach(func() {
+			receptorClient.GetDesiredLRPStub = nil
+			receptorClient.GetDesiredLRPReturns(receptor.DesiredLRPResponse{}, errors.New("boom"))
+		})
+
+		It("does not delete it", func() {
+			err := subject.Recreate(logger, desiredLRP("some-guid"))
+			Ω(err).Should(MatchError("boom"))
+			Ω(receptorClient.DeleteDesiredLRPCallCount()).Should(Equal(0))
+		})
+	})
+
+	Context("when the old instances are still running", func() {
+		BeforeEach(func() {
+			receptorClient.ActualLRPsByProcessGuidStub = func(string) ([]receptor.ActualLRPResponse, error) {
+				if receptorClient.ActualLRPsByProcessGuidCallCount() == 1 {
+					return []receptor.ActualLRPResponse{{ProcessGuid: "some-guid"}}, nil
+				}
+				return []receptor.ActualLRPResponse{}, nil
+			}
+		})
+
+		It("waits for them to retire before creating the LRP", func() {
+			done := make(chan error)
+			go func() {
+				done <- subject.Recreate(logger, desiredLRP("some-guid"))
+			}()
+
+			Eventually(receptorClient.ActualLRPsByProcessGuidCallCount).Should(Equal(1))
+			Consistently(receptorClient.CreateDesiredLRPCallCount).Should(Equal(0))
+
+			clock.Increment(time.Second)
+
+			Eventually(done).Should(Receive(BeNil()))
+			Ω(receptorClient.CreateDesiredLRPCallCount()).Should(Equal(1))
+		})
+	})
+
+	Context("when another recreation creates the LRP first", func() {
+		BeforeEach(func() {
+			receptorClient.CreateDesiredLRPReturns(receptor.Error{Type: receptor.DesiredLRPAlreadyExists})
+		})
+
+		Context("and it created the same LRP", func() {
+			BeforeEach(func() {
+				receptorClient.GetDesiredLRPStub = func(processGuid string) (receptor.DesiredLRPResponse, error) {
+					if receptorClient.GetDesiredLRPCallCount() == 1 {
+						return receptor.DesiredLRPResponse{ProcessGuid: processGuid, MemoryMB: 128}, nil
+					}
+					return receptor.DesiredLRPResponse{ProcessGuid: processGuid, MemoryMB: 256}, nil
+				}
+			})
+
+			It("accepts the other recreation", func() {
+				err := subject.Recreate(logger, desiredLRP("some-guid"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(receptorClient.DeleteDesiredLRPCallCount()).Should(Equal(1))
+				Ω(receptorClient.CreateDesiredLRPCallCount()).Should(Equal(1))
+			})
+		})
+
+		Context("and it keeps creating a different LRP", func() {
+			It("starts over a few times and then gives up", func() {
+				err := subject.Recreate(logger, desiredLRP("some-guid"))
+				Ω(err).Should(Equal(recreator.ErrRecreateContended))
+
+				Ω(receptorClient.CreateDesiredLRPCallCount()).Should(Equal(3))
+			})
+		})
+	})
+
+	Context("when the same LRP is recreated twice at once", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			receptorClient.CreateDesiredLRPStub = func(receptor.DesiredLRPCreateRequest) error {
+				<-release
+				return nil
+			}
+		})
+
+		It("runs one recreation after the other", func() {
+			for i := 0; i < 2; i++ {
+				go subject.Recreate(logger, desiredLRP("some-guid"))
+			}
+
+			Eventually(receptorClient.CreateDesiredLRPCallCount).Should(Equal(1))
+			Consistently(receptorClient.DeleteDesiredLRPCallCount).Should(Equal(1))
+
+			release <- struct{}{}
+			Eventually(receptorClient.GetDesiredLRPCallCount).Should(Equal(2))
+
+			release <- struct{}{}
+		})
+	})
+
+	Context("when the LRP is already gone", func() {
+		BeforeEach(func() {
+			receptorClient.DeleteDesiredLRPReturns(receptor.Error{Type: receptor.DesiredLRPNotFound})
+		})
+
+		It("still creates it", func() {
+			err := subject.Recreate(logger, desiredLRP("some-guid"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(receptorClient.CreateDesiredLRPCallCount()).Should(Equal(1))
+		})
+	})
+
+	Context("when deleting the LRP fails", func() {
+		BeforeEach(func() {
+			receptorClient.DeleteDesiredLRPReturns(errors.New("boom"))
+		})
+
+		It("does not create it", func() {
+			err := subject.Recreate(logger, desiredLRP("some-guid"))
+			Ω(err).Should(MatchError("boom"))
+			Ω(receptorClient.CreateDesiredLRPCallCount()).Should(Equal(0))
+		})
+	})
+
+	Context("when creating the LRP fails", func() {
+		BeforeEach(func() {
+			receptorClient.CreateDesiredLRPReturns(errors.New("boom"))
+		})
+
+		It("returns the error", func() {
+			err := subject.Recreate(logger, desiredLRP("some-guid"))
+			Ω(err).Should(MatchError("boom"))
+		})
+	})
+
+	Context("with an interval", func() {
+		BeforeEach(func() {
+			interval = time.Minute
+		})
+
+		It("spaces out the recreations", func() {
+			err := subject.Recreate(logger, desiredLRP("guid-1"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+
+				err := subject.Recreate(logger, desiredLRP("guid-2"))
+				Ω(err).ShouldNot(HaveOccurred())
+			}()
+
+			Consistently(receptorClient.DeleteDesiredLRPCallCount).Should(Equal(1))
+
+			clock.Increment(time.Minute)
+
+			Eventually(done).Should(BeClosed())
+			Ω(receptorClient.DeleteDesiredLRPCallCount()).Should(Equal(2))
+		})
+	})
+
+	Context("when the maximum number of recreations are in flight", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			maxInFlight = 1
+
+			release = make(chan struct{})
+			receptorClient.CreateDesiredLRPStub = func(receptor.DesiredLRPCreateRequest) error {
+				<-release
+				return nil
+			}
+		})
+
+		It("waits for one to finish", func() {
+			for _, guid := range []string{"guid-1", "guid-2"} {
+				go subject.Recreate(logger, desiredLRP(guid))
+			}
+
+			Eventually(receptorClient.DeleteDesiredLRPCallCount).Should(Equal(1))
+			Consistently(receptorClient.DeleteDesiredLRPCallCount).Should(Equal(1))
+
+			release <- struct{}{}
+			Eventually(receptorClient.DeleteDesiredLRPCallCount).Should(Equal(2))
+
+			release <- struct{}{}
+		})
+	})
+})